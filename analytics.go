@@ -0,0 +1,315 @@
+package logshare
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// DistinctValues fetches logs between the start and end timestamps provided and
+// returns the sorted, distinct values of the named field. At most limit values
+// are collected (no cap when limit <= 0); values first seen after the cap is
+// reached are ignored. Logs are not written to the client's destination.
+//
+// When the client requests an explicit set of fields, the field must be one of
+// them. The timestamps are checked, and an empty window reported, as
+// GetFromTimestamp does.
+func (c *Client) DistinctValues(zoneID string, start int64, end int64, field string, limit int) ([]string, *Meta, error) {
+	cl := c.startCall()
+	if err := c.checkRetrieved(zoneID, field); err != nil {
+		return nil, nil, err
+	}
+
+	seen := make(map[string]struct{})
+	meta, err := cl.finishRead(cl.getFromScope(context.Background(), zoneScope(zoneID), start, end, 0, func(log []byte) error {
+		if limit > 0 && len(seen) >= limit {
+			return nil
+		}
+
+		value, ok, err := fieldValue(log, field)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			seen[value] = struct{}{}
+		}
+
+		return nil
+	}))
+	if err != nil {
+		return nil, meta, err
+	}
+
+	values := make([]string, 0, len(seen))
+	for value := range seen {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	return values, meta, nil
+}
+
+// ValueCount is a field value and the number of logs it was seen in.
+type ValueCount struct {
+	Value string
+	Count int
+}
+
+// topNCapacityFactor is how many values TopN tracks per requested result.
+const topNCapacityFactor = 10
+
+// TopN fetches logs between the start and end timestamps provided and returns
+// the n most frequent values of the named field, sorted by descending count
+// (ties by value). Logs are not written to the client's destination. The
+// timestamps are checked, and an empty window reported, as GetFromTimestamp
+// does.
+//
+// To bound memory on high-cardinality fields, at most 10*n values are tracked
+// at once; when a new value arrives the least frequent one is evicted and the
+// new value inherits its count (the "space-saving" algorithm). Each count may
+// therefore be overestimated, by at most N/(10*n) where N is the number of
+// logs in which the field is set, and a value whose true count is within that
+// bound of the nth most frequent may be missing from the results, or reported
+// in place of one that is not.
+func (c *Client) TopN(zoneID string, start int64, end int64, field string, n int) ([]ValueCount, *Meta, error) {
+	cl := c.startCall()
+	if n <= 0 {
+		return nil, nil, errors.New("n must be positive")
+	}
+
+	if err := c.checkRetrieved(zoneID, field); err != nil {
+		return nil, nil, err
+	}
+
+	counter := NewValueCounter(field, n)
+	meta, err := cl.finishRead(cl.getFromScope(context.Background(), zoneScope(zoneID), start, end, 0, counter.Add))
+	if err != nil {
+		return nil, meta, err
+	}
+
+	return counter.Top(), meta, nil
+}
+
+// ValueCounter counts the values of a field across logs as TopN does, for logs
+// that are streamed elsewhere, e.g. to tally a field of the logs written to a
+// destination through WriterFunc. It is not safe for concurrent use.
+type ValueCounter struct {
+	field    string
+	n        int
+	capacity int
+	counts   map[string]int
+}
+
+// NewValueCounter returns a ValueCounter reporting the n most frequent values
+// of the named field.
+func NewValueCounter(field string, n int) *ValueCounter {
+	return &ValueCounter{
+		field:    field,
+		n:        n,
+		capacity: n * topNCapacityFactor,
+		counts:   make(map[string]int),
+	}
+}
+
+// Add counts the field's value in a JSON log. Logs without the field are
+// ignored; an error is returned if the log cannot be decoded.
+func (vc *ValueCounter) Add(log []byte) error {
+	value, ok, err := fieldValue(log, vc.field)
+	if err != nil || !ok {
+		return err
+	}
+
+	if _, ok := vc.counts[value]; !ok && len(vc.counts) >= vc.capacity {
+		evicted, min := "", -1
+		for v, count := range vc.counts {
+			if min < 0 || count < min {
+				evicted, min = v, count
+			}
+		}
+		delete(vc.counts, evicted)
+		vc.counts[value] = min
+	}
+	vc.counts[value]++
+
+	return nil
+}
+
+// Top returns the most frequent values counted so far, as TopN does.
+func (vc *ValueCounter) Top() []ValueCount {
+	top := make([]ValueCount, 0, len(vc.counts))
+	for value, count := range vc.counts {
+		top = append(top, ValueCount{Value: value, Count: count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Value < top[j].Value
+	})
+	if len(top) > vc.n {
+		top = top[:vc.n]
+	}
+
+	return top
+}
+
+// FieldPresenceStats fetches up to count logs between the start and end
+// timestamps provided and returns, for each top-level field seen, the
+// percentage (0-100) of those logs in which it was populated: present, not
+// null and not an empty string. Logs are not written to the client's
+// destination. A small count is usually enough to decide which fields are
+// worth retrieving. The timestamps are checked, and an empty window reported,
+// as GetFromTimestamp does.
+func (c *Client) FieldPresenceStats(zoneID string, start int64, end int64, count int) (map[string]float64, *Meta, error) {
+	cl := c.startCall()
+	populated := make(map[string]int)
+	meta, err := cl.finishRead(cl.getFromScope(context.Background(), zoneScope(zoneID), start, end, count, func(log []byte) error {
+		var record map[string]json.RawMessage
+		if err := json.Unmarshal(log, &record); err != nil {
+			return errors.Wrap(err, "failed to decode log")
+		}
+
+		for field, raw := range record {
+			if v := string(raw); v != "null" && v != `""` {
+				populated[field]++
+			}
+		}
+
+		return nil
+	}))
+	if err != nil {
+		return nil, meta, err
+	}
+
+	stats := make(map[string]float64, len(populated))
+	for field, n := range populated {
+		stats[field] = 100 * float64(n) / float64(meta.Count)
+	}
+
+	return stats, meta, nil
+}
+
+// LastN fetches logs between the start and end timestamps provided and
+// returns the last n of them, oldest first. The whole response is streamed,
+// but only n logs are held in memory at once, however large the window. Logs
+// are not written to the client's destination. The timestamps are checked,
+// and an empty window reported, as GetFromTimestamp does.
+func (c *Client) LastN(zoneID string, start int64, end int64, n int) ([]json.RawMessage, *Meta, error) {
+	cl := c.startCall()
+	if n <= 0 {
+		return nil, nil, errors.New("n must be positive")
+	}
+
+	last := newLastLogs(n)
+	meta, err := cl.finishRead(cl.getFromScope(context.Background(), zoneScope(zoneID), start, end, 0, last.add))
+	if err != nil {
+		return nil, meta, err
+	}
+
+	kept := last.logs()
+	logs := make([]json.RawMessage, len(kept))
+	for i, log := range kept {
+		logs[i] = log
+	}
+
+	return logs, meta, nil
+}
+
+// lastLogs keeps the last n logs passed to add, in a ring.
+type lastLogs struct {
+	ring [][]byte
+	// The slot of the oldest log once the ring is full.
+	next int
+}
+
+func newLastLogs(n int) *lastLogs {
+	return &lastLogs{ring: make([][]byte, 0, n)}
+}
+
+// add keeps a copy of log, dropping the oldest log kept if the ring is full. It
+// can be used as a streamLogs handler.
+func (l *lastLogs) add(log []byte) error {
+	// The scanner reuses its buffer, so each log is copied, reusing the
+	// slot's previous allocation where it is large enough.
+	if len(l.ring) < cap(l.ring) {
+		l.ring = append(l.ring, append([]byte(nil), log...))
+		return nil
+	}
+
+	l.ring[l.next] = append(l.ring[l.next][:0], log...)
+	l.next = (l.next + 1) % len(l.ring)
+	return nil
+}
+
+// logs returns the logs kept, oldest first.
+func (l *lastLogs) logs() [][]byte {
+	logs := make([][]byte, 0, len(l.ring))
+	logs = append(logs, l.ring[l.next:]...)
+	return append(logs, l.ring[:l.next]...)
+}
+
+// checkRetrieved returns an error if the client requests an explicit set of
+// fields for the zone that does not include field.
+func (c *Client) checkRetrieved(zoneID string, field string) error {
+	fields := c.fieldsFor(zoneID)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	for _, f := range fields {
+		if f == field {
+			return nil
+		}
+	}
+
+	return errors.Errorf("field %q is not among the retrieved fields", field)
+}
+
+// fieldValue returns the value of the named field in a JSON log as a string.
+// String values are unquoted; other values are returned as their JSON text.
+// ok is false when the field is absent or null.
+func fieldValue(log []byte, field string) (value string, ok bool, err error) {
+	var record map[string]json.RawMessage
+	if err := json.Unmarshal(log, &record); err != nil {
+		return "", false, errors.Wrap(err, "failed to decode log")
+	}
+
+	raw, ok := record[field]
+	if !ok || string(raw) == "null" {
+		return "", false, nil
+	}
+
+	if len(raw) > 0 && raw[0] == '"' {
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return "", false, errors.Wrapf(err, "failed to decode field %q", field)
+		}
+		return value, true, nil
+	}
+
+	return string(raw), true, nil
+}
+
+// rayIDKey is how the RayID field begins in a log returned by the API.
+var rayIDKey = []byte(`"RayID":"`)
+
+// rayIDOf returns the value of the RayID field of a JSON log, or "" if it has
+// none. It scans for the field rather than decoding the log, as it is called
+// for every log streamed.
+func rayIDOf(log []byte) string {
+	i := bytes.Index(log, rayIDKey)
+	if i < 0 {
+		return ""
+	}
+
+	value := log[i+len(rayIDKey):]
+	end := bytes.IndexByte(value, '"')
+	if end < 0 {
+		return ""
+	}
+
+	return string(value[:end])
+}
@@ -0,0 +1,148 @@
+package logshare
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestLastLogs(t *testing.T) {
+	last := newLastLogs(3)
+	for i := 1; i <= 7; i++ {
+		last.add([]byte(fmt.Sprintf("log %d", i)))
+	}
+
+	var got []string
+	for _, log := range last.logs() {
+		got = append(got, string(log))
+	}
+	if want := "log 5,log 6,log 7"; strings.Join(got, ",") != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLastN(t *testing.T) {
+	ts := newTestServer(t, "{\"a\":1}\n{\"a\":2}\n{\"a\":3}\n")
+	defer ts.Close()
+
+	client, err := New("key", "email", &Options{ApiURL: ts.URL + "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{2, `{"a":2},{"a":3}`},
+		{3, `{"a":1},{"a":2},{"a":3}`},
+		{5, `{"a":1},{"a":2},{"a":3}`},
+	}
+
+	for _, tt := range tests {
+		logs, _, err := client.LastN("zone", 0, 120, tt.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, log := range logs {
+			got = append(got, string(log))
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("LastN(%d) = %s, want %s", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestValueCounter(t *testing.T) {
+	counter := NewValueCounter("country", 2)
+	for _, log := range []string{
+		`{"country":"us"}`,
+		`{"country":"gb"}`,
+		`{"country":"us"}`,
+		`{"country":"fr"}`,
+		`{"country":"gb"}`,
+		`{"country":"us"}`,
+		`{"other":1}`,
+	} {
+		if err := counter.Add([]byte(log)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	top := counter.Top()
+	want := []ValueCount{{"us", 3}, {"gb", 2}}
+	if len(top) != len(want) || top[0] != want[0] || top[1] != want[1] {
+		t.Errorf("got %v, want %v", top, want)
+	}
+
+	if err := counter.Add([]byte("not json")); err == nil {
+		t.Error("expected an error for a log that is not JSON")
+	}
+}
+
+func TestAnalyticsChecksTimestamps(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, "{\"a\":1}\n")
+	}))
+	defer ts.Close()
+
+	client, err := New("key", "email", &Options{ApiURL: ts.URL, RetentionWindow: 7 * 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(30*24*3600, 0)
+	client.now = func() time.Time { return now }
+
+	calls := []struct {
+		name string
+		call func(start int64, end int64) error
+	}{
+		{"DistinctValues", func(start int64, end int64) error {
+			_, _, err := client.DistinctValues("zone", start, end, "a", 0)
+			return err
+		}},
+		{"TopN", func(start int64, end int64) error {
+			_, _, err := client.TopN("zone", start, end, "a", 1)
+			return err
+		}},
+		{"FieldPresenceStats", func(start int64, end int64) error {
+			_, _, err := client.FieldPresenceStats("zone", start, end, 10)
+			return err
+		}},
+		{"LastN", func(start int64, end int64) error {
+			_, _, err := client.LastN("zone", start, end, 1)
+			return err
+		}},
+	}
+
+	old := now.Add(-8 * 24 * time.Hour).Unix()
+	recent := now.Add(-6 * 24 * time.Hour).Unix()
+	for _, c := range calls {
+		if err := c.call(recent+60, recent); err == nil {
+			t.Errorf("%s: got no error for a start after the end", c.name)
+		}
+		if err := c.call(old, old+60); errors.Cause(err) != ErrBeyondRetention {
+			t.Errorf("%s: got %v, want ErrBeyondRetention", c.name, err)
+		}
+		if requests != 0 {
+			t.Fatalf("%s: got %d requests for invalid windows, want none", c.name, requests)
+		}
+
+		if err := c.call(recent, recent+60); err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+		if requests != 1 {
+			t.Fatalf("%s: got %d requests, want 1", c.name, requests)
+		}
+		requests = 0
+	}
+}
@@ -0,0 +1,76 @@
+package logshare
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// APIError is returned when the API responds with a non-2xx status. Callers
+// can inspect it with errors.As:
+//
+//	var apiErr *logshare.APIError
+//	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusForbidden {
+//		...
+//	}
+type APIError struct {
+	StatusCode int
+	// The response body, up to 1MB.
+	Body string
+	// The errors listed in the response, when it is a standard Cloudflare
+	// API envelope ({"success":false,"errors":[...]}).
+	Errors []APIErrorDetail
+}
+
+// APIErrorDetail is a single error from a Cloudflare API error response.
+type APIErrorDetail struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func newAPIError(statusCode int, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: statusCode, Body: string(body)}
+
+	var envelope struct {
+		Errors []APIErrorDetail `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &envelope); err == nil {
+		apiErr.Errors = envelope.Errors
+	}
+
+	return apiErr
+}
+
+func (e *APIError) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("HTTP status %d: request failed: %s", e.StatusCode, e.Body)
+	}
+
+	messages := make([]string, len(e.Errors))
+	for i, detail := range e.Errors {
+		messages[i] = fmt.Sprintf("%s (code %d)", detail.Message, detail.Code)
+	}
+
+	return fmt.Sprintf("HTTP status %d: request failed: %s", e.StatusCode, strings.Join(messages, "; "))
+}
+
+// wrappedError annotates an error with a message, like errors.Wrap, but can
+// be unwrapped by both errors.Cause and the standard library's errors.Is and
+// errors.As.
+type wrappedError struct {
+	msg string
+	err error
+}
+
+// wrapf annotates err with a formatted message. It returns nil if err is nil.
+func wrapf(err error, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+
+	return &wrappedError{msg: fmt.Sprintf(format, args...), err: err}
+}
+
+func (w *wrappedError) Error() string { return w.msg + ": " + w.err.Error() }
+func (w *wrappedError) Cause() error  { return w.err }
+func (w *wrappedError) Unwrap() error { return w.err }
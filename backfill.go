@@ -0,0 +1,200 @@
+package logshare
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// BackfillPlan is a precomputed list of windows to fetch for a zone, which can
+// be saved to a file and executed, or resumed, later. See PlanBackfill.
+type BackfillPlan struct {
+	ZoneID string `json:"zone_id"`
+	// The fields the plan was made with. A plan can only be executed by a
+	// client requesting the same fields, so that every window has the same
+	// shape.
+	Fields  []string       `json:"fields,omitempty"`
+	Windows []BackfillStep `json:"windows"`
+
+	// The file the plan is kept in, if any.
+	path string
+}
+
+// BackfillStep is a single window of a BackfillPlan, in Unix seconds.
+type BackfillStep struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	// Whether the window has been fetched, and how many logs it returned.
+	Done  bool `json:"done"`
+	Count int  `json:"count"`
+}
+
+// PlanBackfill splits the range from start to end into consecutive windows of
+// windowSize, returning a plan that ExecutePlan can run. Plans can be saved
+// with Save so that a backfill interrupted part way through can be resumed.
+func (c *Client) PlanBackfill(zoneID string, start time.Time, end time.Time, windowSize time.Duration) (*BackfillPlan, error) {
+	if !end.After(start) {
+		return nil, errors.Errorf("end (%s) must be after start (%s)", end, start)
+	}
+
+	if windowSize < time.Second {
+		return nil, errors.New("windowSize must be at least one second")
+	}
+
+	plan := &BackfillPlan{
+		ZoneID: zoneID,
+		Fields: append([]string(nil), c.fieldsFor(zoneID)...),
+	}
+
+	size := durationSeconds(windowSize)
+	for from, until := start.Unix(), end.Unix(); from < until; from += size {
+		to := from + size
+		if to > until {
+			to = until
+		}
+		plan.Windows = append(plan.Windows, BackfillStep{Start: from, End: to})
+	}
+
+	return plan, nil
+}
+
+// LoadBackfillPlan reads a plan previously written with Save. Executing it
+// keeps the file up to date.
+func LoadBackfillPlan(path string) (*BackfillPlan, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read backfill plan")
+	}
+
+	plan := &BackfillPlan{}
+	if err := json.Unmarshal(data, plan); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode backfill plan %s", path)
+	}
+	plan.path = path
+
+	return plan, nil
+}
+
+// Save writes the plan to path as JSON. The file is replaced atomically, and
+// from then on ExecutePlan updates it as each window completes.
+func (p *BackfillPlan) Save(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode backfill plan")
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "failed to save backfill plan")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "failed to save backfill plan")
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "failed to save backfill plan")
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return errors.Wrap(err, "failed to save backfill plan")
+	}
+	p.path = path
+
+	return nil
+}
+
+// ExecutePlan fetches all logs for each window of the plan in order, marking
+// windows done as they complete and saving the plan after each one if it has
+// been saved to or loaded from a file. With resume set, windows already done
+// are skipped; otherwise every window is fetched again.
+//
+// A window is marked done only after its logs have been written, so a
+// backfill interrupted mid-window fetches that window again when resumed:
+// logs are delivered at least once.
+//
+// The returned Meta aggregates the windows fetched by this call, as for
+// GetFromTimeRange.
+func (c *Client) ExecutePlan(ctx context.Context, plan *BackfillPlan, resume bool) (*Meta, error) {
+	cl := c.startCall()
+	return cl.finish(cl.executePlan(ctx, plan, resume))
+}
+
+func (c *call) executePlan(ctx context.Context, plan *BackfillPlan, resume bool) (*Meta, error) {
+	if !sameFields(plan.Fields, c.fieldsFor(plan.ZoneID)) {
+		return nil, errors.Errorf("backfill plan was made for fields %v, but the client requests %v", plan.Fields, c.fieldsFor(plan.ZoneID))
+	}
+
+	total := &Meta{}
+	began := c.makeTimestamp()
+
+	for i := range plan.Windows {
+		step := &plan.Windows[i]
+		if resume && step.Done {
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			total.Duration = c.makeTimestamp() - began
+			return total, err
+		}
+
+		meta, err := c.getFromTimestamp(ctx, plan.ZoneID, step.Start, step.End, 0)
+		if meta != nil {
+			mergeMeta(total, meta)
+			total.Chunks = append(total.Chunks, ChunkInfo{
+				Start:      step.Start,
+				End:        step.End,
+				Count:      meta.Count,
+				Duration:   meta.Duration,
+				StatusCode: meta.StatusCode,
+				Truncated:  meta.Truncated,
+			})
+		}
+
+		empty := meta != nil && !isNotEntitled(err) && (meta.StatusCode == http.StatusNoContent || errors.Cause(err) == ErrNoLogs)
+		if err != nil && !empty {
+			total.Duration = c.makeTimestamp() - began
+			return total, wrapf(err, "failed to fetch window %d-%d", step.Start, step.End)
+		}
+
+		step.Done = true
+		step.Count = 0
+		if meta != nil {
+			step.Count = meta.Count
+		}
+
+		if plan.path != "" {
+			if err := plan.Save(plan.path); err != nil {
+				total.Duration = c.makeTimestamp() - began
+				return total, err
+			}
+		}
+	}
+
+	total.Duration = c.makeTimestamp() - began
+	return total, nil
+}
+
+// sameFields reports whether a and b list the same fields in the same order.
+func sameFields(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,61 @@
+package logshare
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExecutePlanResume(t *testing.T) {
+	ts := newTestServer(t, "{\"a\":1}\n")
+	defer ts.Close()
+
+	client, err := New("key", "email", &Options{ApiURL: ts.URL + "/", Dest: ioutil.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := client.PlanBackfill("zone", time.Unix(0, 0), time.Unix(150, 0), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Windows) != 3 {
+		t.Fatalf("got %d windows, want 3", len(plan.Windows))
+	}
+
+	path := filepath.Join(t.TempDir(), "plan.json")
+	plan.Windows[0].Done = true
+	if err := plan.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadBackfillPlan(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := client.ExecutePlan(context.Background(), loaded, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Count != 2 || meta.BytesRead != 16 || len(meta.Chunks) != 2 {
+		t.Errorf("got Count %d, BytesRead %d and %d chunks, want 2, 16 and 2", meta.Count, meta.BytesRead, len(meta.Chunks))
+	}
+
+	saved, err := LoadBackfillPlan(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := saved.Windows[2]; !last.Done || last.Count != 1 {
+		t.Errorf("got last window %+v, want it done with one log", last)
+	}
+
+	other, err := New("key", "email", &Options{ApiURL: ts.URL + "/", Dest: ioutil.Discard, Fields: []string{"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.ExecutePlan(context.Background(), saved, true); err == nil {
+		t.Error("expected an error for a plan made with other fields")
+	}
+}
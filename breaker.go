@@ -0,0 +1,136 @@
+package logshare
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultBreakerCooldown = 30 * time.Second
+
+// ErrCircuitOpen is returned, without contacting the API, while the client's
+// circuit breaker is open after repeated failures. See
+// Options.BreakerThreshold.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// BreakerState is the state of a client's circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets requests through. This is the state of clients
+	// without a breaker.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails requests with ErrCircuitOpen until the cooldown has
+	// passed.
+	BreakerOpen
+	// BreakerHalfOpen lets a single probe request through: the breaker
+	// closes if it succeeds and opens again if it fails.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// breaker is a consecutive-failure circuit breaker, shared by a client and
+// its clones. It is safe for concurrent use.
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	// Whether the half-open probe request is in flight.
+	probing bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration, now func() time.Time) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown, now: now}
+}
+
+// allow returns ErrCircuitOpen if a request may not be made now.
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return errors.Wrapf(ErrCircuitOpen, "%d consecutive failures, retrying after %s", b.failures, b.openedAt.Add(b.cooldown).Format(time.RFC3339))
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return errors.Wrap(ErrCircuitOpen, "waiting on a probe request")
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// record updates the breaker with the result of a request it allowed. Only
+// transport errors, 429s and 5xx responses count as failures: other errors,
+// such as a bad request or a failing destination, say nothing about the
+// health of the API. Requests cancelled by their caller are released instead.
+func (b *breaker) record(meta *Meta, err error) {
+	failed := err != nil && (meta == nil || meta.StatusCode == http.StatusTooManyRequests || meta.StatusCode >= 500)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !failed {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// release frees the half-open probe slot of a request it allowed whose result
+// is not recorded, such as one cancelled by its caller, leaving the state and
+// failure count unchanged.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *breaker) current() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// BreakerState returns the state of the client's circuit breaker, e.g. for
+// exporting as a metric. Clients without a breaker are always closed.
+func (c *Client) BreakerState() BreakerState {
+	if c.breaker == nil {
+		return BreakerClosed
+	}
+
+	return c.breaker.current()
+}
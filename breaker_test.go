@@ -0,0 +1,47 @@
+package logshare
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBreakerIgnoresCancelled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	client, err := New("key", "email", &Options{
+		ApiURL:           ts.URL + "/",
+		Dest:             ioutil.Discard,
+		BreakerThreshold: 2,
+		RetryPolicy:      &RetryPolicy{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Requests the caller cancels or times out do not count as failures.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	timeout, cancelTimeout := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancelTimeout()
+	for _, ctx := range []context.Context{ctx, timeout, ctx} {
+		client.GetFromTimestampContext(ctx, "zone", 1, 2, 0)
+	}
+	if state := client.BreakerState(); state != BreakerClosed {
+		t.Fatalf("got %s after cancelled requests, want closed", state)
+	}
+
+	// Failures from the API still open it.
+	for i := 0; i < 2; i++ {
+		client.GetFromTimestamp("zone", 1, 2, 0)
+	}
+	if state := client.BreakerState(); state != BreakerOpen {
+		t.Fatalf("got %s after failed requests, want open", state)
+	}
+}
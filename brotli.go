@@ -0,0 +1,21 @@
+//go:build brotli
+// +build brotli
+
+package logshare
+
+import (
+	"io"
+	"io/ioutil"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Building with the brotli tag adds support for responses with a "br"
+// Content-Encoding, and asks for them with Options.Gzip, without adding the
+// dependency to default builds.
+func init() {
+	bodyDecoders["br"] = func(r io.Reader) (io.ReadCloser, error) {
+		return ioutil.NopCloser(brotli.NewReader(r)), nil
+	}
+	acceptEncodings = append(acceptEncodings, "br")
+}
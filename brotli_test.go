@@ -0,0 +1,46 @@
+//go:build brotli
+// +build brotli
+
+package logshare
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestBrotliResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "br") {
+			t.Errorf("got Accept-Encoding %q, want br", r.Header.Get("Accept-Encoding"))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "br")
+		bw := brotli.NewWriter(w)
+		bw.Write([]byte("{\"a\":1}\n{\"a\":2}\n"))
+		bw.Close()
+	}))
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	client, err := New("key", "email", &Options{ApiURL: ts.URL + "/", Dest: &buf, Gzip: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := client.GetFromTimestamp("zone", 1, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Count != 2 || meta.ContentEncoding != "br" {
+		t.Errorf("got Count %d and ContentEncoding %q, want 2 and br", meta.Count, meta.ContentEncoding)
+	}
+	if want := "{\"a\":1}\n{\"a\":2}\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,46 @@
+package logshare
+
+// Clone returns a new client with the same configuration, which can be used
+// alongside this one, e.g. to give each goroutine its own client. The clone
+// shares the caches of entitlement and field listings, the write throttle,
+// the rate limit, request coalescing and the circuit breaker with this client,
+// so that they apply across both.
+//
+// The clone writes to the same destination. If the client owns its
+// destination (see DestChain, EncryptKey and CompressOutput), the destination
+// is still closed when this client's call returns, and never by the clone or
+// its Close method; wrap shared writers with NewSyncWriter. With DestByKey,
+// the clone opens partition writers of its own. With FormatCSV, the header row is written
+// once per destination across both clients.
+func (c *Client) Clone() *Client {
+	clone := &Client{}
+	*clone = *c
+
+	clone.closers = nil
+	clone.userDests = nil
+	clone.headers = cloneHeader(c.headers)
+	if c.partitioner != nil {
+		clone.partitioner = newPartitioner(c.partitioner.field, c.partitioner.open, c.partitioner.max)
+		clone.csvHeaders = newCSVHeaders()
+	}
+
+	return clone
+}
+
+// WithCredentials returns a clone of the client, as Clone does, that
+// authenticates with the given credentials instead: an API token, or an API
+// key and email if apiToken is empty. The clone shares the HTTP client, and so
+// its connections, with this client, which is unchanged. This suits serving
+// zones across several accounts from one process.
+//
+// Zones found not to have Log Share enabled are remembered per credentials,
+// so the clone starts with an empty memo (see ResetEntitlement).
+func (c *Client) WithCredentials(apiKey string, apiEmail string, apiToken string) *Client {
+	clone := c.Clone()
+	clone.apiKey = apiKey
+	clone.apiEmail = apiEmail
+	clone.apiToken = apiToken
+	clone.entitlement = newEntitlementMemo()
+
+	return clone
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// credentialsFileName is the name of the file in the home directory that
+// credentials are read from when neither their flags nor their environment
+// variables are set.
+const credentialsFileName = ".cloudflare"
+
+// apiCredentials are the values used to authenticate with the API.
+type apiCredentials struct {
+	apiKey   string
+	apiEmail string
+	apiToken string
+}
+
+// empty reports whether no credential has been given.
+func (cr apiCredentials) empty() bool {
+	return cr.apiKey == "" && cr.apiEmail == "" && cr.apiToken == ""
+}
+
+// fillFromFile reads credentials from the file at path, as lines of
+// CF_API_KEY=..., CF_API_EMAIL=... and CF_API_TOKEN=..., ignoring blank lines
+// and lines starting with '#'. The file is only consulted when no credential
+// was given by a flag or environment variable, so that the two sources are
+// never mixed. A missing file is not an error.
+func (cr *apiCredentials) fillFromFile(path string) error {
+	if !cr.empty() {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "failed to open credentials file")
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return errors.Errorf("%s:%d: expected KEY=value", path, n)
+		}
+
+		value := strings.Trim(strings.TrimSpace(parts[1]), `"'`)
+		switch strings.TrimSpace(parts[0]) {
+		case "CF_API_KEY":
+			cr.apiKey = value
+		case "CF_API_EMAIL":
+			cr.apiEmail = value
+		case "CF_API_TOKEN":
+			cr.apiToken = value
+		default:
+			return errors.Errorf("%s:%d: unknown key %q", path, n, parts[0])
+		}
+	}
+
+	return errors.Wrap(scanner.Err(), "failed to read credentials file")
+}
+
+// defaultCredentialsFile returns the path of the credentials file in the home
+// directory, or "" if there is no home directory.
+func defaultCredentialsFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, credentialsFileName)
+}
+
+// loadCredentials returns the credentials given by flags (or their
+// environment variables), falling back to the credentials file.
+func loadCredentials(key string, email string, token string) (apiCredentials, error) {
+	cr := apiCredentials{apiKey: key, apiEmail: email, apiToken: token}
+	if path := defaultCredentialsFile(); path != "" {
+		if err := cr.fillFromFile(path); err != nil {
+			return cr, err
+		}
+	}
+
+	return cr, nil
+}
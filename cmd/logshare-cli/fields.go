@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cloudflare/logshare"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+var commands = []cli.Command{
+	{
+		Name:  "fields",
+		Usage: "Inspect the log fields available to zones",
+		Subcommands: []cli.Command{
+			{
+				Name:      "diff",
+				Usage:     "List the fields available to only one of two zones",
+				ArgsUsage: "<zone-id-a> <zone-id-b>",
+				Action:    fieldsDiff,
+			},
+			{
+				Name:      "summary",
+				Usage:     "Show how often each field is populated in a sample of a zone's logs",
+				ArgsUsage: "<zone-id>",
+				Action:    fieldsSummary,
+				Flags: []cli.Flag{
+					cli.Int64Flag{
+						Name:  "since",
+						Value: time.Now().Add(-time.Minute * 30).Unix(),
+						Usage: "The timestamp (in Unix seconds) to sample logs from. Defaults to 30 minutes behind the current time",
+					},
+					cli.Int64Flag{
+						Name:  "until",
+						Value: time.Now().Add(-time.Minute * 20).Unix(),
+						Usage: "The timestamp (in Unix seconds) to sample logs to. Defaults to 20 minutes behind the current time",
+					},
+					cli.IntFlag{
+						Name:  "count",
+						Value: 100,
+						Usage: "The number of logs to sample",
+					},
+				},
+			},
+		},
+	},
+}
+
+// fieldsDiff prints the fields available to only one of the two zones given
+// as arguments.
+func fieldsDiff(c *cli.Context) error {
+	if c.NArg() != 2 {
+		cli.ShowSubcommandHelp(c)
+		return errors.New("fields diff requires exactly two zone IDs")
+	}
+	zoneA, zoneB := c.Args().Get(0), c.Args().Get(1)
+
+	client, err := newClient(c)
+	if err != nil {
+		return err
+	}
+
+	onlyA, onlyB, err := client.DiffFields(zoneA, zoneB)
+	if err != nil {
+		return errors.Wrap(err, "failed to compare fields")
+	}
+
+	printFields("Only in "+zoneA, onlyA)
+	printFields("Only in "+zoneB, onlyB)
+
+	return nil
+}
+
+// fieldsSummary prints each field available to the zone given as an argument,
+// with how often it was populated in a sample of logs and its description.
+func fieldsSummary(c *cli.Context) error {
+	if c.NArg() != 1 {
+		cli.ShowSubcommandHelp(c)
+		return errors.New("fields summary requires exactly one zone ID")
+	}
+	zoneID := c.Args().First()
+
+	if c.Int("count") <= 0 {
+		return errors.New("count must be positive")
+	}
+
+	client, err := newClient(c)
+	if err != nil {
+		return err
+	}
+
+	descriptions, err := client.ListFields(zoneID)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch field names")
+	}
+
+	stats, meta, err := client.FieldPresenceStats(zoneID, c.Int64("since"), c.Int64("until"), c.Int("count"))
+	if err != nil {
+		return errors.Wrap(err, "failed to sample logs")
+	}
+
+	names := make([]string, 0, len(descriptions))
+	for name := range descriptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Printf("Sampled %d logs\n", meta.Count)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tPOPULATED\tDESCRIPTION")
+	for _, name := range names {
+		fmt.Fprintf(tw, "%s\t%.1f%%\t%s\n", name, stats[name], descriptions[name])
+	}
+
+	return tw.Flush()
+}
+
+func printFields(heading string, fields []string) {
+	fmt.Printf("%s (%d):\n", heading, len(fields))
+	for _, field := range fields {
+		fmt.Printf("  %s\n", field)
+	}
+}
+
+// newClient creates a client authenticated with the global credential flags,
+// their environment variables or the credentials file.
+func newClient(c *cli.Context) (*logshare.Client, error) {
+	creds, err := loadCredentials(c.GlobalString("api-key"), c.GlobalString("api-email"), c.GlobalString("api-token"))
+	if err != nil {
+		return nil, err
+	}
+
+	return logshare.New(creds.apiKey, creds.apiEmail, &logshare.Options{
+		APIToken: creds.apiToken,
+	})
+}
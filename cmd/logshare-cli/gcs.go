@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// objectWriter uploads logs to Google Storage, rolling over to a new object
+// each time limit bytes have been written to the current one. Objects are
+// only ever rolled over between writes, and the client writes each log in a
+// single call, so logs are never split across objects.
+//
+// With no limit, everything is written to a single object named name.
+// Otherwise objects are named by inserting an index before the extension of
+// name, e.g. logs_0000.json, logs_0001.json.
+type objectWriter struct {
+	bucket     *gcs.BucketHandle
+	bucketName string
+	name       string
+	limit      int64
+
+	w       *gcs.Writer
+	cancel  context.CancelFunc
+	n       int64
+	objects []string
+}
+
+func newObjectWriter(bucket *gcs.BucketHandle, bucketName string, name string, limit int64) *objectWriter {
+	return &objectWriter{
+		bucket:     bucket,
+		bucketName: bucketName,
+		name:       name,
+		limit:      limit,
+	}
+}
+
+func (o *objectWriter) Write(p []byte) (int, error) {
+	if o.w != nil && o.limit > 0 && o.n >= o.limit {
+		if err := o.finalize(); err != nil {
+			return 0, err
+		}
+	}
+
+	if o.w == nil {
+		o.open()
+	}
+
+	n, err := o.w.Write(p)
+	o.n += int64(n)
+	if err != nil {
+		// Abandon the object rather than finalizing it part-written;
+		// objects already finalized are unaffected.
+		o.cancel()
+		o.w = nil
+		return n, errors.Wrapf(err, "failed to write to %s", o.objects[len(o.objects)-1])
+	}
+
+	return n, nil
+}
+
+// Close finalizes the current object. An empty object is created if nothing
+// was written, so that a pull always produces output.
+func (o *objectWriter) Close() error {
+	if o.w == nil && len(o.objects) == 0 {
+		o.open()
+	}
+
+	if o.w == nil {
+		return nil
+	}
+
+	return o.finalize()
+}
+
+// Abort abandons the current object without finalizing it, so that a failed
+// pull does not leave a partial object behind. Objects already finalized when
+// rolling over are kept.
+func (o *objectWriter) Abort() {
+	if o.w != nil {
+		o.cancel()
+		o.w = nil
+	}
+}
+
+// Objects returns the gs:// URLs of the objects written so far.
+func (o *objectWriter) Objects() []string {
+	return append([]string(nil), o.objects...)
+}
+
+func (o *objectWriter) open() {
+	name := o.name
+	if o.limit > 0 {
+		ext := path.Ext(name)
+		name = fmt.Sprintf("%s_%04d%s", strings.TrimSuffix(name, ext), len(o.objects), ext)
+	}
+
+	var ctx context.Context
+	ctx, o.cancel = context.WithCancel(context.Background())
+	o.w = o.bucket.Object(name).NewWriter(ctx)
+	o.n = 0
+	o.objects = append(o.objects, "gs://"+o.bucketName+"/"+name)
+}
+
+func (o *objectWriter) finalize() error {
+	err := o.w.Close()
+	o.cancel()
+	o.w = nil
+
+	return errors.Wrapf(err, "failed to upload %s", o.objects[len(o.objects)-1])
+}
+
+// verifyBucket checks that objects can be uploaded to the bucket, by writing
+// and then deleting a small probe object, so that a pull can fail before it
+// starts rather than when the upload is finalized at the end.
+func verifyBucket(bucket *gcs.BucketHandle, bucketName string) error {
+	ctx := context.Background()
+	name := fmt.Sprintf(".logshare-probe-%d", time.Now().UnixNano())
+
+	w := bucket.Object(name).NewWriter(ctx)
+	if _, err := w.Write([]byte("logshare-cli bucket check\n")); err != nil {
+		w.Close()
+		return errors.Wrapf(err, "cannot write to gs://%s: check that you have permission to create objects", bucketName)
+	}
+
+	if err := w.Close(); err != nil {
+		return errors.Wrapf(err, "cannot write to gs://%s: check that you have permission to create objects", bucketName)
+	}
+
+	if err := bucket.Object(name).Delete(ctx); err != nil {
+		return errors.Wrapf(err, "cannot delete the probe object gs://%s/%s", bucketName, name)
+	}
+
+	return nil
+}
+
+// Values of --gcs-partition-span.
+const (
+	spanStart = "start"
+	spanError = "error"
+)
+
+// hivePartition returns the Hive-style partition prefix, such as
+// "dt=2018-01-10/hour=18/", for the UTC hour of a pull from start to end (in
+// Unix seconds, end exclusive). When the pull spans more than one hour the
+// hour it starts in is used, unless span is "error".
+func hivePartition(start int64, end int64, span string) (string, error) {
+	from := time.Unix(start, 0).UTC()
+	if end > start && span == spanError {
+		if last := time.Unix(end-1, 0).UTC(); last.Truncate(time.Hour) != from.Truncate(time.Hour) {
+			return "", errors.Errorf("pull from %s to %s spans more than one hour partition", from.Format(time.RFC3339), time.Unix(end, 0).UTC().Format(time.RFC3339))
+		}
+	}
+
+	return from.Format("dt=2006-01-02/hour=15/"), nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// runPostHook runs command through the system shell with env added to the
+// current environment, and logs its exit status.
+func runPostHook(command string, env []string) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		log.Printf("post-hook failed: %v", exitErr)
+		return
+	} else if err != nil {
+		log.Printf("post-hook could not be run: %v", err)
+		return
+	}
+
+	log.Printf("post-hook exited with status 0")
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"compress/gzip"
+	"encoding/json"
 	"io"
 	"log"
 	"os"
@@ -14,6 +16,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/urfave/cli"
 	"golang.org/x/net/context"
+	"google.golang.org/api/option"
 )
 
 // Rev is set on build time and should contain the git commit logshare-cli
@@ -29,19 +32,38 @@ func main() {
 	app.Name = "logshare-cli"
 	app.Usage = "Fetch request logs from Cloudflare's Enterprise Log Share API"
 	app.Flags = flags
+	app.Commands = commands
 	app.Version = Rev
+	if Rev != "" {
+		logshare.Version = Rev
+	}
 
 	conf := &config{}
 	app.Action = run(conf)
 	if err := app.Run(os.Args); err != nil {
 		log.Println(err)
+		os.Exit(1)
+	}
+}
+
+// newGoogleClient creates a Google Storage client, authenticating with the
+// given service account credentials file if set, or with Application Default
+// Credentials otherwise.
+func newGoogleClient(ctx context.Context, credentialsFile string) (*gcs.Client, error) {
+	var opts []option.ClientOption
+	if credentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(credentialsFile))
 	}
+
+	return gcs.NewClient(ctx, opts...)
 }
 
-func setupGoogleStr(projectID string, bucketName string, filename string, skipCreateBucket bool) (*gcs.Writer, error) {
+// setupGoogleBucket returns a handle to the named bucket, creating it first
+// unless skipCreateBucket is set.
+func setupGoogleBucket(projectID string, bucketName string, skipCreateBucket bool, credentialsFile string) (*gcs.BucketHandle, error) {
 	gCtx := context.Background()
 
-	gClient, error := gcs.NewClient(gCtx)
+	gClient, error := newGoogleClient(gCtx, credentialsFile)
 	if error != nil {
 		return nil, error
 	}
@@ -57,8 +79,52 @@ func setupGoogleStr(projectID string, bucketName string, filename string, skipCr
 		}
 	}
 
+	return gBucket, error
+}
+
+func setupGoogleStr(projectID string, bucketName string, filename string, skipCreateBucket bool, credentialsFile string) (*gcs.Writer, error) {
+	gBucket, err := setupGoogleBucket(projectID, bucketName, skipCreateBucket, credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+
 	obj := gBucket.Object(filename)
-	return obj.NewWriter(gCtx), error
+	return obj.NewWriter(context.Background()), nil
+}
+
+// replayFromGCS streams a previously uploaded log object back through the
+// client, decompressing it first if the object name ends in ".gz". It is kept
+// in the CLI, which already talks to Cloud Storage, so that the library does
+// not depend on it; programs can pass an object's reader to ReplayFromReader.
+func replayFromGCS(ctx context.Context, client *logshare.Client, bucketName string, objectName string, credentialsFile string) (*logshare.Meta, error) {
+	gClient, err := newGoogleClient(ctx, credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer gClient.Close()
+
+	r, err := gClient.Bucket(bucketName).Object(objectName).NewReader(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open gs://%s/%s", bucketName, objectName)
+	}
+	defer r.Close()
+
+	var src io.Reader = r
+	if strings.HasSuffix(objectName, ".gz") {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decompress gs://%s/%s", bucketName, objectName)
+		}
+		defer gz.Close()
+		src = gz
+	}
+
+	meta, err := client.ReplayFromReader(src)
+	if meta != nil {
+		meta.URL = "gs://" + bucketName + "/" + objectName
+	}
+
+	return meta, err
 }
 
 func run(conf *config) func(c *cli.Context) error {
@@ -68,140 +134,610 @@ func run(conf *config) func(c *cli.Context) error {
 			return err
 		}
 
+		if conf.zoneFile != "" {
+			return pullZones(conf)
+		}
+
 		// Populate the zoneID if it wasn't supplied.
-		if conf.zoneID == "" {
-			cf, err := cloudflare.New(conf.apiKey, conf.apiEmail)
-			id, err := cf.ZoneIDByName(conf.zoneName)
+		if conf.zoneID == "" && conf.zoneName != "" {
+			id, err := zoneIDByName(conf, conf.zoneName)
 			if err != nil {
 				cli.ShowAppHelp(c)
-				return errors.Wrap(err, "could not find a zone for the given ID")
+				return err
 			}
 
 			conf.zoneID = id
 		}
 
-		var outputWriter io.Writer
-		if conf.googleStorageBucket != "" {
-			fileName := "cloudflare_els_" + conf.zoneID + "_" + strconv.Itoa(int(time.Now().Unix())) + ".json"
+		return pull(conf)
+	}
+}
 
-			gcsWriter, err := setupGoogleStr(conf.googleProjectID, conf.googleStorageBucket, fileName, conf.skipCreateBucket)
-			if err != nil {
+// pull fetches the logs of conf.zoneID (or replays conf.replayObject) and
+// writes them to the configured outputs. Uploads are only completed if the
+// pull succeeds, so that a failed pull never leaves a partial object behind.
+func pull(conf *config) (err error) {
+	var outputWriter io.Writer = os.Stdout
+	output := "stdout"
+
+	var gcsWriter *objectWriter
+	defer func() {
+		if gcsWriter != nil {
+			gcsWriter.Abort()
+		}
+	}()
+
+	baseName := "cloudflare_els_" + conf.zoneID + "_" + strconv.Itoa(int(time.Now().Unix()))
+	if conf.gcsPartition {
+		prefix, err := hivePartition(conf.startTime, conf.endTime, conf.gcsPartitionSpan)
+		if err != nil {
+			return err
+		}
+		baseName = prefix + baseName
+	}
+	if conf.googleStorageBucket != "" && conf.replayObject == "" {
+		fileName := baseName + ".json"
+
+		bucket, err := setupGoogleBucket(conf.googleProjectID, conf.googleStorageBucket, conf.skipCreateBucket, conf.googleCredentialsFile)
+		if err != nil {
+			return err
+		}
+		if conf.verifyBucket {
+			if err := verifyBucket(bucket, conf.googleStorageBucket); err != nil {
 				return err
 			}
-			defer gcsWriter.Close()
-			outputWriter = gcsWriter
-		}
-
-		client, err := logshare.New(
-			conf.apiKey,
-			conf.apiEmail,
-			&logshare.Options{
-				Fields:          conf.fields,
-				Dest:            outputWriter,
-				Sample:          conf.sample,
-				TimestampFormat: conf.timestampFormat,
-			})
+		}
+
+		gcsWriter = newObjectWriter(bucket, conf.googleStorageBucket, fileName, conf.gcsRotateBytes)
+		outputWriter = gcsWriter
+	}
+
+	var s3Out *s3Writer
+	s3Name := "S3"
+	defer func() {
+		if s3Out != nil {
+			s3Out.Abort(err)
+		}
+	}()
+
+	if conf.s3Bucket != "" && conf.replayObject == "" {
+		key := s3Key(conf.s3KeyPrefix, baseName+".json")
+
+		var err error
+		if s3Out, err = setupS3Writer(conf.s3Bucket, conf.s3Region, key); err != nil {
+			return err
+		}
+		outputWriter = s3Out
+		output = "s3://" + conf.s3Bucket + "/" + key
+	}
+
+	if conf.r2Bucket != "" && conf.replayObject == "" {
+		key := baseName + ".json"
+
+		var err error
+		if s3Out, err = setupR2Writer(conf.r2AccountID, conf.r2AccessKeyID, conf.r2SecretAccessKey, conf.r2Bucket, key); err != nil {
+			return err
+		}
+		outputWriter = s3Out
+		output = "r2://" + conf.r2Bucket + "/" + key
+		s3Name = "R2"
+	}
+
+	// The local archive of the logs, from --output-file or --output-dir.
+	var outputFile io.WriteCloser
+	defer func() {
+		if outputFile != nil {
+			outputFile.Close()
+		}
+	}()
+
+	var rotating *logshare.RotatingFileWriter
+	if conf.outputFile != "" {
+		f, err := os.Create(conf.outputFile)
 		if err != nil {
+			return errors.Wrap(err, "failed to create output-file")
+		}
+		outputFile = f
+		outputWriter = outputFile
+		output = conf.outputFile
+	} else if conf.outputDir != "" {
+		var err error
+		if rotating, err = logshare.NewRotatingFileWriter(conf.outputDir, baseName+".json", conf.maxFileSize); err != nil {
 			return err
 		}
+		outputFile = rotating
+		outputWriter = outputFile
+	}
 
-		// Based on the combination of flags, call against the correct log
-		// endpoint.
-		var meta *logshare.Meta
+	counter := &countingWriter{w: outputWriter}
 
-		if conf.rayID != "" {
-			meta, err = client.GetFromRayID(conf.zoneID, conf.rayID)
-			if err != nil {
-				return errors.Wrap(err, "failed to fetch via ray ID")
-			}
+	opts := &logshare.Options{
+		APIToken:        conf.apiToken,
+		Fields:          conf.fields,
+		AllFields:       conf.allFields,
+		Checksum:        conf.checksum,
+		Sample:          conf.sample,
+		TimestampFormat: logshare.TimestampFormat(conf.timestampFormat),
+		CountOrder:      logshare.CountOrder(conf.countOrder),
+	}
 
-		} else if conf.listFields {
-			meta, err = client.FetchFieldNames(conf.zoneID)
-			if err != nil {
-				return errors.Wrap(err, "failed to fetch field names")
-			}
-		} else {
-			meta, err = client.GetFromTimestamp(
-				conf.zoneID, conf.startTime, conf.endTime, conf.count)
-			if err != nil {
-				return errors.Wrap(err, "failed to fetch via timestamp")
-			}
+	if conf.httpTimeout > 0 {
+		opts.HTTPTimeout = conf.httpTimeout
+	}
+
+	// The archived output is always NDJSON. It is also written to the
+	// terminal only when --stdout-format is given, in that format.
+	switch {
+	case outputFile != nil && conf.stdoutFormatSet:
+		opts.MultiDest = []logshare.OutputSpec{
+			{Writer: counter, Format: logshare.FormatJSON},
+			{Writer: os.Stdout, Format: logshare.OutputFormat(conf.stdoutFormat)},
+		}
+	case outputFile != nil, gcsWriter != nil, s3Out != nil:
+		opts.Dest = counter
+	default:
+		opts.Dest = counter
+		opts.Format = logshare.OutputFormat(conf.stdoutFormat)
+	}
+
+	var progressWriter io.Writer
+	if conf.progressFile != "" {
+		f, err := os.OpenFile(conf.progressFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return errors.Wrap(err, "failed to open progress-file")
+		}
+		defer f.Close()
+		progressWriter = f
+	}
+
+	// Tally statuses from a JSON copy of each log, whatever format the
+	// logs are written in.
+	var tally *statusTally
+	if conf.statusSummary {
+		tally = newStatusTally()
+		if len(opts.MultiDest) == 0 {
+			opts.MultiDest = []logshare.OutputSpec{{Writer: opts.Dest, Format: opts.Format}}
+			opts.Dest, opts.Format = nil, ""
+		}
+		opts.MultiDest = append(opts.MultiDest, logshare.OutputSpec{Writer: tally, Format: logshare.FormatJSON})
+	}
+
+	opts.ProgressWriter = progressWriter
+	if conf.verbose {
+		opts.Logger = stdLogger{}
+	}
+
+	client, err := logshare.New(conf.apiKey, conf.apiEmail, opts)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if conf.clockSkewThreshold > 0 && conf.replayObject == "" {
+		warnClockSkew(client, conf.zoneID, conf.clockSkewThreshold)
+	}
+
+	// Based on the combination of flags, call against the correct log
+	// endpoint.
+	var meta *logshare.Meta
+
+	if conf.replayObject != "" {
+		meta, err = replayFromGCS(context.Background(), client, conf.googleStorageBucket, conf.replayObject, conf.googleCredentialsFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to replay from Google Storage")
+		}
+	} else if rayIDs := strings.Split(conf.rayID, ","); len(rayIDs) > 1 {
+		meta, err = client.GetFromRayIDs(conf.zoneID, rayIDs)
+		if err != nil {
+			return errors.Wrap(err, "failed to fetch via ray IDs")
+		}
+	} else if conf.rayID != "" {
+		meta, err = client.GetFromRayID(conf.zoneID, conf.rayID)
+		if err != nil {
+			return errors.Wrap(err, "failed to fetch via ray ID")
+		}
+
+	} else if conf.listFields {
+		meta, err = client.FetchFieldNames(conf.zoneID)
+		if err != nil {
+			return errors.Wrap(err, "failed to fetch field names")
+		}
+	} else {
+		meta, err = client.GetFromTimestamp(
+			conf.zoneID, conf.startTime, conf.endTime, conf.count)
+		if err != nil {
+			return errors.Wrap(err, "failed to fetch via timestamp")
 		}
+	}
 
+	if conf.outputMeta == "json" {
+		// A single line of JSON, without the log prefix, for wrapper
+		// scripts to parse.
+		if err := json.NewEncoder(os.Stderr).Encode(meta); err != nil {
+			return errors.Wrap(err, "failed to write meta")
+		}
+	} else {
 		log.Printf("HTTP status %d | %dms | %s",
 			meta.StatusCode, meta.Duration, meta.URL)
-		log.Printf("Retrieved %d logs", meta.Count)
+		log.Printf("Retrieved %d logs (%d bytes)", meta.Count, meta.BytesRead)
+		if meta.Checksum != "" {
+			log.Printf("SHA-256 of logs read: %s", meta.Checksum)
+		}
+		for _, warning := range meta.Warnings {
+			log.Printf("Warning: %s", warning)
+		}
+	}
+	if tally != nil {
+		log.Printf("Status summary: %s", tally)
+	}
+
+	// Finalize the upload before handing the output to the post-hook.
+	if gcsWriter != nil {
+		err := gcsWriter.Close()
+		output = strings.Join(gcsWriter.Objects(), " ")
+		gcsWriter = nil
+		if err != nil {
+			return errors.Wrap(err, "failed to upload logs to Google Storage")
+		}
+	}
+
+	if s3Out != nil {
+		err := s3Out.Close()
+		s3Out = nil
+		if err != nil {
+			return errors.Wrapf(err, "failed to upload logs to %s", s3Name)
+		}
+	}
+
+	if outputFile != nil {
+		err := outputFile.Close()
+		outputFile = nil
+		if rotating != nil {
+			output = strings.Join(rotating.Files(), " ")
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to write output")
+		}
+	}
+
+	if conf.writeConfig {
+		var bucket string
+		if conf.googleStorageBucket != "" && conf.replayObject == "" {
+			bucket = conf.googleStorageBucket
+		}
+
+		where, err := writeSidecar(sidecar{
+			ZoneID:    conf.zoneID,
+			RayID:     conf.rayID,
+			StartTime: conf.startTime,
+			EndTime:   conf.endTime,
+			Count:     conf.count,
+			Output:    output,
+			Logs:      meta.Count,
+			Config:    client.Config(),
+		}, bucket, baseName+".config.json", conf.googleCredentialsFile)
+		if err != nil {
+			return err
+		}
+		log.Printf("Wrote configuration to %s", where)
+	}
+
+	if conf.postHook != "" {
+		runPostHook(conf.postHook, []string{
+			"LOGSHARE_COUNT=" + strconv.Itoa(meta.Count),
+			"LOGSHARE_BYTES=" + strconv.FormatInt(counter.n, 10),
+			"LOGSHARE_OUTPUT=" + output,
+			"LOGSHARE_ZONE=" + conf.zoneID,
+		})
+	}
+
+	return nil
+}
 
-		return nil
+// stdLogger passes the library's diagnostics to the standard logger, so that
+// they share its prefix and output.
+type stdLogger struct{}
+
+func (stdLogger) Printf(format string, args ...interface{}) {
+	log.Printf(format, args...)
+}
+
+// zoneIDByName looks up the ID of the named zone.
+func zoneIDByName(conf *config, name string) (string, error) {
+	cf, err := cloudflare.New(conf.apiKey, conf.apiEmail)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := cf.ZoneIDByName(name)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not find a zone named %s", name)
+	}
+
+	return id, nil
+}
+
+// warnClockSkew logs a warning if the local clock differs from the API's by
+// more than threshold. Failing to check is not fatal.
+func warnClockSkew(client *logshare.Client, zoneID string, threshold time.Duration) {
+	skew, err := client.CheckClockSkew(zoneID)
+	if err != nil {
+		log.Printf("Could not check for clock skew: %v", err)
+		return
+	}
+
+	if skew > threshold || skew < -threshold {
+		log.Printf("Warning: the local clock differs from the API's by %v; start-time and end-time may not select the logs you expect", skew)
 	}
 }
 
 func parseFlags(conf *config, c *cli.Context) error {
-	conf.apiKey = c.String("api-key")
-	conf.apiEmail = c.String("api-email")
+	creds, err := loadCredentials(c.String("api-key"), c.String("api-email"), c.String("api-token"))
+	if err != nil {
+		return err
+	}
+	conf.apiKey = creds.apiKey
+	conf.apiEmail = creds.apiEmail
+	conf.apiToken = creds.apiToken
 	conf.zoneID = c.String("zone-id")
 	conf.zoneName = c.String("zone-name")
+	conf.zoneFile = c.String("zone-file")
 	conf.startTime = c.Int64("start-time")
 	conf.endTime = c.Int64("end-time")
 	conf.count = c.Int("count")
+	conf.countOrder = c.String("count-order")
 	conf.timestampFormat = c.String("timestamp-format")
 	conf.sample = c.Float64("sample")
-	conf.fields = c.StringSlice("fields")
+	conf.fields = splitList(c.StringSlice("fields"))
+	conf.allFields = c.Bool("all-fields")
+	conf.checksum = c.Bool("checksum")
 	conf.listFields = c.Bool("list-fields")
 	conf.googleStorageBucket = c.String("google-storage-bucket")
 	conf.googleProjectID = c.String("google-project-id")
 	conf.skipCreateBucket = c.Bool("skip-create-bucket")
+	conf.googleCredentialsFile = c.String("google-credentials-file")
 	conf.rayID = c.String("ray-id")
+	conf.timeRangeSet = c.IsSet("start-time") || c.IsSet("end-time")
+	conf.replayObject = c.String("replay-object")
+	conf.postHook = c.String("post-hook")
+	conf.progressFile = c.String("progress-file")
+	conf.writeConfig = c.Bool("write-config")
+	conf.gcsRotateBytes = c.Int64("gcs-rotate-bytes")
+	conf.gcsPartition = c.Bool("gcs-partition")
+	conf.gcsPartitionSpan = c.String("gcs-partition-span")
+	conf.clockSkewThreshold = c.Duration("clock-skew-threshold")
+	conf.httpTimeout = c.Duration("http-timeout")
+	conf.outputMeta = c.String("output-meta")
+	conf.outputFile = c.String("output-file")
+	conf.outputDir = c.String("output-dir")
+	conf.maxFileSize = c.Int64("max-file-size")
+	conf.stdoutFormat = c.String("stdout-format")
+	conf.stdoutFormatSet = c.IsSet("stdout-format")
+	conf.verifyBucket = c.Bool("verify-bucket")
+	conf.statusSummary = c.Bool("status-summary")
+	conf.verbose = c.Bool("verbose")
+	conf.s3Bucket = c.String("s3-bucket")
+	conf.s3Region = c.String("s3-region")
+	conf.s3KeyPrefix = c.String("s3-key-prefix")
+	conf.r2Bucket = c.String("r2-bucket")
+	conf.r2AccountID = c.String("r2-account-id")
+	conf.r2AccessKeyID = c.String("r2-access-key-id")
+	conf.r2SecretAccessKey = c.String("r2-secret-access-key")
 
 	return conf.Validate()
 }
 
 type config struct {
-	apiKey              string
-	apiEmail            string
-	zoneID              string
-	zoneName            string
-	startTime           int64
-	endTime             int64
-	count               int
-	timestampFormat     string
-	sample              float64
-	fields              []string
-	listFields          bool
-	googleStorageBucket string
-	googleProjectID     string
-	skipCreateBucket    bool
-	rayID               string
+	apiKey                string
+	apiEmail              string
+	apiToken              string
+	zoneID                string
+	zoneFile              string
+	zoneName              string
+	startTime             int64
+	endTime               int64
+	count                 int
+	countOrder            string
+	timestampFormat       string
+	sample                float64
+	fields                []string
+	allFields             bool
+	checksum              bool
+	listFields            bool
+	googleStorageBucket   string
+	googleProjectID       string
+	skipCreateBucket      bool
+	googleCredentialsFile string
+	rayID                 string
+	timeRangeSet          bool
+	replayObject          string
+	postHook              string
+	progressFile          string
+	writeConfig           bool
+	gcsRotateBytes        int64
+	gcsPartition          bool
+	gcsPartitionSpan      string
+	clockSkewThreshold    time.Duration
+	httpTimeout           time.Duration
+	outputMeta            string
+	outputFile            string
+	outputDir             string
+	maxFileSize           int64
+	stdoutFormat          string
+	stdoutFormatSet       bool
+	verifyBucket          bool
+	statusSummary         bool
+	verbose               bool
+	s3Bucket              string
+	s3Region              string
+	s3KeyPrefix           string
+	r2Bucket              string
+	r2AccountID           string
+	r2AccessKeyID         string
+	r2SecretAccessKey     string
+}
+
+// splitList splits each of values on commas, dropping surrounding whitespace
+// and empty entries, so that a flag can be repeated or given a list.
+func splitList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				list = append(list, v)
+			}
+		}
+	}
+
+	return list
 }
 
 func (conf *config) Validate() error {
-	if conf.apiKey == "" || conf.apiEmail == "" {
-		return errors.New("Must provide both api-key and api-email")
+	if conf.apiToken != "" {
+		if conf.zoneName != "" && conf.zoneID == "" {
+			return errors.New("zone-id must be used instead of zone-name with api-token")
+		}
+	} else if conf.apiKey == "" || conf.apiEmail == "" {
+		return errors.New("Must provide both api-key and api-email, or api-token, by flag, by the CF_API_KEY, CF_API_EMAIL and CF_API_TOKEN environment variables, or in ~/" + credentialsFileName)
+	}
+
+	if conf.outputMeta != "text" && conf.outputMeta != "json" {
+		return errors.Errorf("output-meta must be 'text' or 'json', got %q", conf.outputMeta)
+	}
+
+	if _, err := logshare.ParseCountOrder(conf.countOrder); err != nil {
+		return errors.Wrap(err, "invalid count-order")
+	}
+
+	if _, err := logshare.ParseTimestampFormat(conf.timestampFormat); err != nil {
+		return errors.Wrap(err, "invalid timestamp-format")
 	}
 
-	if conf.zoneID == "" && conf.zoneName == "" {
+	if conf.zoneFile != "" {
+		if conf.zoneID != "" || conf.zoneName != "" {
+			return errors.New("zone-file cannot be combined with zone-id or zone-name")
+		}
+		if conf.rayID != "" || conf.replayObject != "" {
+			return errors.New("zone-file cannot be combined with ray-id or replay-object")
+		}
+		if conf.outputFile != "" {
+			return errors.New("zone-file cannot be combined with output-file, which would be overwritten for each zone: use output-dir instead")
+		}
+	} else if conf.zoneID == "" && conf.zoneName == "" && conf.replayObject == "" {
 		return errors.New("zone-name OR zone-id must be set")
 	}
 
-	if conf.sample != 0.0 && (conf.sample < 0.1 || conf.sample > 0.9) {
-		return errors.New("sample must be between 0.1 and 0.9")
+	if conf.rayID != "" && conf.timeRangeSet {
+		return errors.New("ray-id cannot be combined with start-time or end-time")
 	}
 
-	if (conf.googleStorageBucket == "") != (conf.googleProjectID == "") {
+	if conf.sample < 0 || conf.sample > 1 {
+		return errors.New("sample must be greater than 0 and at most 1")
+	}
+
+	if conf.replayObject != "" {
+		if conf.googleStorageBucket == "" {
+			return errors.New("google-storage-bucket must be provided to replay an object from Google Storage")
+		}
+	} else if (conf.googleStorageBucket == "") != (conf.googleProjectID == "") {
 		return errors.New("Both google-storage-bucket and google-project-id must be provided to upload to Google Storage")
 	}
 
+	if (conf.s3Bucket == "") != (conf.s3Region == "") {
+		return errors.New("Both s3-bucket and s3-region must be provided to upload to S3")
+	}
+
+	if conf.s3Bucket != "" && conf.replayObject == "" {
+		if conf.googleStorageBucket != "" || conf.outputFile != "" {
+			return errors.New("s3-bucket cannot be combined with google-storage-bucket or output-file")
+		}
+	} else if conf.s3KeyPrefix != "" {
+		return errors.New("s3-key-prefix requires s3-bucket")
+	}
+
+	r2Set := conf.r2Bucket != "" || conf.r2AccountID != "" || conf.r2AccessKeyID != "" || conf.r2SecretAccessKey != ""
+	if r2Set && (conf.r2Bucket == "" || conf.r2AccountID == "" || conf.r2AccessKeyID == "" || conf.r2SecretAccessKey == "") {
+		return errors.New("r2-bucket, r2-account-id, r2-access-key-id and r2-secret-access-key must all be provided to upload to R2")
+	}
+
+	if conf.r2Bucket != "" && conf.replayObject == "" && (conf.s3Bucket != "" || conf.googleStorageBucket != "" || conf.outputFile != "") {
+		return errors.New("r2-bucket cannot be combined with s3-bucket, google-storage-bucket or output-file")
+	}
+
+	if conf.outputFile != "" && conf.googleStorageBucket != "" && conf.replayObject == "" {
+		return errors.New("output-file cannot be used when uploading to Google Storage")
+	}
+
+	if conf.outputDir != "" && conf.outputFile != "" {
+		return errors.New("output-dir cannot be combined with output-file")
+	}
+
+	if conf.outputDir != "" && conf.replayObject == "" && (conf.googleStorageBucket != "" || conf.s3Bucket != "" || conf.r2Bucket != "") {
+		return errors.New("output-dir cannot be used when uploading to Google Storage, S3 or R2")
+	}
+
+	if conf.maxFileSize != 0 && conf.outputDir == "" {
+		return errors.New("max-file-size requires output-dir")
+	}
+
+	if conf.maxFileSize < 0 {
+		return errors.New("max-file-size cannot be negative")
+	}
+
+	if conf.allFields && len(conf.fields) > 0 {
+		return errors.New("all-fields cannot be combined with fields")
+	}
+
+	if conf.statusSummary && len(conf.fields) > 0 && !hasField(conf.fields, statusField) {
+		return errors.Errorf("status-summary requires %s to be among the fields", statusField)
+	}
+
+	if conf.verifyBucket && (conf.googleStorageBucket == "" || conf.replayObject != "") {
+		return errors.New("verify-bucket requires uploading to a google-storage-bucket")
+	}
+
+	if conf.gcsPartition {
+		if conf.googleStorageBucket == "" || conf.replayObject != "" {
+			return errors.New("gcs-partition requires uploading to a google-storage-bucket")
+		}
+		if conf.rayID != "" || conf.listFields {
+			return errors.New("gcs-partition can only be used when fetching logs by timestamp")
+		}
+		if conf.gcsPartitionSpan != spanStart && conf.gcsPartitionSpan != spanError {
+			return errors.Errorf("gcs-partition-span must be %q or %q", spanStart, spanError)
+		}
+	}
+
+	if conf.gcsRotateBytes < 0 {
+		return errors.New("gcs-rotate-bytes cannot be negative")
+	}
+
+	if conf.googleCredentialsFile != "" {
+		f, err := os.Open(conf.googleCredentialsFile)
+		if err != nil {
+			return errors.Wrap(err, "google-credentials-file cannot be read")
+		}
+		f.Close()
+	}
+
 	return nil
 }
 
 var flags = []cli.Flag{
 	cli.StringFlag{
-		Name:  "api-key",
-		Usage: "Your Cloudflare API key",
+		Name:   "api-key",
+		Usage:  "Your Cloudflare API key",
+		EnvVar: "CF_API_KEY",
 	},
 	cli.StringFlag{
-		Name:  "api-email",
-		Usage: "The email address associated with your Cloudflare API key and account",
+		Name:   "api-email",
+		Usage:  "The email address associated with your Cloudflare API key and account",
+		EnvVar: "CF_API_EMAIL",
+	},
+	cli.StringFlag{
+		Name:   "api-token",
+		Usage:  "A Cloudflare API token with access to logs, instead of api-key and api-email. Requires zone-id",
+		EnvVar: "CF_API_TOKEN",
 	},
 	cli.StringFlag{
 		Name:  "zone-id",
@@ -211,9 +747,13 @@ var flags = []cli.Flag{
 		Name:  "zone-name",
 		Usage: "The name of the zone you are requesting logs for. logshare will automatically fetch the ID of this zone from the Cloudflare API",
 	},
+	cli.StringFlag{
+		Name:  "zone-file",
+		Usage: "A file listing zone IDs or names, one per line, to pull the same logs for in turn. Each zone's logs are written to their own file (with output-dir) or object",
+	},
 	cli.StringFlag{
 		Name:  "ray-id",
-		Usage: "The ray ID to request logs from (instead of a timestamp)",
+		Usage: "The ray ID to request logs from (instead of a timestamp). Pass a comma-separated list to fetch several",
 	},
 	cli.Int64Flag{
 		Name:  "start-time",
@@ -230,10 +770,15 @@ var flags = []cli.Flag{
 		Value: 1,
 		Usage: "The number (count) of logs to retrieve. Pass '-1' to retrieve all logs for the given time period",
 	},
+	cli.StringFlag{
+		Name:  "count-order",
+		Value: "first",
+		Usage: "Which logs to keep when limited by count: 'first' or 'last' (fetches the whole period and keeps the last logs)",
+	},
 	cli.Float64Flag{
 		Name:  "sample",
 		Value: 0.0,
-		Usage: "The sampling rate from 0.1 (10%) to 0.9 (90%) to use when retrieving logs",
+		Usage: "The sampling rate to use when retrieving logs, greater than 0 and at most 1, e.g. 0.01 (1%) or 0.25 (25%)",
 	},
 	cli.StringFlag{
 		Name:  "timestamp-format",
@@ -242,12 +787,45 @@ var flags = []cli.Flag{
 	},
 	cli.StringSliceFlag{
 		Name:  "fields",
-		Usage: "Select specific fields to retrieve in the log response. Pass a comma-separated list to fields to specify multiple fields.",
+		Usage: "Select specific fields to retrieve in the log response. Pass a comma-separated list, or repeat the flag, to specify multiple fields.",
+	},
+	cli.BoolFlag{
+		Name:  "all-fields",
+		Usage: "Request every field available to the zone, rather than the default fields",
+	},
+	cli.BoolFlag{
+		Name:  "checksum",
+		Usage: "Compute a SHA-256 of the logs read, reported with the number of logs retrieved",
 	},
 	cli.BoolFlag{
 		Name:  "list-fields",
 		Usage: "List the available log fields for use with the --fields flag",
 	},
+	cli.StringFlag{
+		Name:  "output-file",
+		Usage: "Write logs as newline-delimited JSON to this file rather than stdout. Pass --stdout-format to write them to stdout too",
+	},
+	cli.StringFlag{
+		Name:  "output-dir",
+		Usage: "Write logs as newline-delimited JSON to files in this directory rather than stdout. Pass --stdout-format to write them to stdout too. See --max-file-size",
+	},
+	cli.Int64Flag{
+		Name:  "max-file-size",
+		Usage: "Start a new file in --output-dir after this many bytes, e.g. 104857600 for 100MB. Files are numbered, and logs are never split across files",
+	},
+	cli.StringFlag{
+		Name:  "stdout-format",
+		Value: "json",
+		Usage: "The format to write logs to stdout in: one of 'json', 'pretty' (indented JSON), 'logfmt' or 'csv' (both require --fields). With --output-file or --output-dir, logs are only written to stdout when this is given",
+	},
+	cli.BoolFlag{
+		Name:  "status-summary",
+		Usage: "Once logs have been fetched, print a count of logs by EdgeResponseStatus class (2xx=... 3xx=... 4xx=... 5xx=...) to stderr",
+	},
+	cli.BoolFlag{
+		Name:  "verbose",
+		Usage: "Log retries, rate limit waits and progress through windows to stderr",
+	},
 	cli.StringFlag{
 		Name:  "google-storage-bucket",
 		Usage: "Full URI to a Google Cloud Storage Bucket to upload logs to",
@@ -260,4 +838,84 @@ var flags = []cli.Flag{
 		Name:  "skip-create-bucket",
 		Usage: "Do not attempt to create the bucket specified by --google-storage-bucket",
 	},
+	cli.StringFlag{
+		Name:  "s3-bucket",
+		Usage: "An AWS S3 bucket to upload logs to, using the AWS SDK's default credentials",
+	},
+	cli.StringFlag{
+		Name:  "s3-region",
+		Usage: "The AWS region of --s3-bucket",
+	},
+	cli.StringFlag{
+		Name:  "s3-key-prefix",
+		Usage: "A prefix (e.g. a path) for the keys of objects uploaded to --s3-bucket",
+	},
+	cli.StringFlag{
+		Name:  "r2-bucket",
+		Usage: "A Cloudflare R2 bucket to upload logs to",
+	},
+	cli.StringFlag{
+		Name:  "r2-account-id",
+		Usage: "The Cloudflare account ID that owns --r2-bucket",
+	},
+	cli.StringFlag{
+		Name:   "r2-access-key-id",
+		Usage:  "The access key ID of an R2 API token for --r2-bucket",
+		EnvVar: "R2_ACCESS_KEY_ID",
+	},
+	cli.StringFlag{
+		Name:   "r2-secret-access-key",
+		Usage:  "The secret access key of an R2 API token for --r2-bucket",
+		EnvVar: "R2_SECRET_ACCESS_KEY",
+	},
+	cli.BoolFlag{
+		Name:  "verify-bucket",
+		Usage: "Before fetching logs, check that objects can be uploaded to --google-storage-bucket by writing and deleting a probe object",
+	},
+	cli.Int64Flag{
+		Name:  "gcs-rotate-bytes",
+		Usage: "Start a new Google Storage object, named with an incrementing index, once this many bytes have been written to the current one. 0 writes a single object",
+	},
+	cli.BoolFlag{
+		Name:  "gcs-partition",
+		Usage: "Prefix Google Storage object names with Hive-style partitions for the hour the pull starts in, e.g. dt=2018-01-10/hour=18/",
+	},
+	cli.StringFlag{
+		Name:  "gcs-partition-span",
+		Value: spanStart,
+		Usage: "What --gcs-partition does when a pull spans more than one hour: 'start' to use the hour it starts in, or 'error' to refuse the pull",
+	},
+	cli.StringFlag{
+		Name:  "google-credentials-file",
+		Usage: "Path to a service account key file to authenticate to Google Storage with, instead of Application Default Credentials",
+	},
+	cli.StringFlag{
+		Name:  "replay-object",
+		Usage: "Stream a previously uploaded log object from --google-storage-bucket instead of fetching from the API. Objects ending in .gz are decompressed",
+	},
+	cli.StringFlag{
+		Name:  "post-hook",
+		Usage: "A shell command to run after a successful pull. LOGSHARE_COUNT, LOGSHARE_BYTES, LOGSHARE_OUTPUT and LOGSHARE_ZONE are set in its environment",
+	},
+	cli.StringFlag{
+		Name:  "progress-file",
+		Usage: "Write progress updates as JSON lines to this file while logs are streamed, e.g. /dev/fd/3",
+	},
+	cli.DurationFlag{
+		Name:  "clock-skew-threshold",
+		Usage: "Before fetching logs, compare the local clock with the API's and warn if they differ by more than this, e.g. 30s. Skewed clocks lead to requests for the wrong time range",
+	},
+	cli.StringFlag{
+		Name:  "output-meta",
+		Value: "text",
+		Usage: "How to report the result of a pull on stderr: 'text' for a human-readable summary, or 'json' for a JSON object describing it (status_code, duration_ms, count, url and more)",
+	},
+	cli.DurationFlag{
+		Name:  "http-timeout",
+		Usage: "The timeout for each API request, including streaming its logs, e.g. 10m. Defaults to 30s; raise it for large pulls, which can take several minutes",
+	},
+	cli.BoolFlag{
+		Name:  "write-config",
+		Usage: "Write the effective configuration as a .config.json sidecar next to the logs: an object in --google-storage-bucket, or a file in the current directory. Credentials are never included",
+	},
 }
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   []string
+	}{
+		{nil, nil},
+		{[]string{"RayID"}, []string{"RayID"}},
+		{[]string{"RayID,ClientIP"}, []string{"RayID", "ClientIP"}},
+		{[]string{"RayID, ClientIP,", "EdgeStartTimestamp"}, []string{"RayID", "ClientIP", "EdgeStartTimestamp"}},
+	}
+
+	for _, tt := range tests {
+		if got := splitList(tt.values); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitList(%q) = %q, want %q", tt.values, got, tt.want)
+		}
+	}
+}
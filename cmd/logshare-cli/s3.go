@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/pkg/errors"
+)
+
+// s3Writer streams logs to an S3 (or R2) object through a pipe, so that the upload
+// proceeds while logs are fetched rather than buffering the whole pull. The
+// object is complete once Close returns without error.
+type s3Writer struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+// setupS3Writer starts an upload to the named object, using the AWS SDK's
+// default credential chain (environment, shared config or instance role).
+func setupS3Writer(bucket string, region string, key string) (*s3Writer, error) {
+	return newS3Writer(&aws.Config{Region: aws.String(region)}, bucket, key)
+}
+
+// setupR2Writer starts an upload to the named object in a Cloudflare R2
+// bucket, through R2's S3-compatible endpoint for the account.
+func setupR2Writer(accountID string, accessKeyID string, secretAccessKey string, bucket string, key string) (*s3Writer, error) {
+	return newS3Writer(&aws.Config{
+		Endpoint:         aws.String("https://" + accountID + ".r2.cloudflarestorage.com"),
+		Region:           aws.String("auto"),
+		Credentials:      credentials.NewStaticCredentials(accessKeyID, secretAccessKey, ""),
+		S3ForcePathStyle: aws.Bool(true),
+	}, bucket, key)
+}
+
+func newS3Writer(config *aws.Config, bucket string, key string) (*s3Writer, error) {
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create an AWS session")
+	}
+
+	pr, pw := io.Pipe()
+	w := &s3Writer{pw: pw, done: make(chan error, 1)}
+
+	uploader := s3manager.NewUploader(sess)
+	go func() {
+		_, err := uploader.Upload(&s3manager.UploadInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+			Body:   pr,
+		})
+		// Unblock any pending Write if the upload fails part way.
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+
+	return w, nil
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+// Close finishes the upload and waits for it to complete.
+func (w *s3Writer) Close() error {
+	w.pw.Close()
+	return <-w.done
+}
+
+// Abort abandons the upload with err, so that no object is created from a
+// failed pull, and waits for the uploader to stop.
+func (w *s3Writer) Abort(err error) error {
+	w.pw.CloseWithError(err)
+	return <-w.done
+}
+
+// s3Key returns the key of an object named name under prefix.
+func s3Key(prefix string, name string) string {
+	if prefix == "" {
+		return name
+	}
+
+	return strings.TrimSuffix(prefix, "/") + "/" + name
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/cloudflare/logshare"
+	"github.com/pkg/errors"
+)
+
+// sidecar records how a pull was made, so that archived logs describe
+// themselves. It never contains credentials.
+type sidecar struct {
+	ZoneID    string                  `json:"zone_id,omitempty"`
+	RayID     string                  `json:"ray_id,omitempty"`
+	StartTime int64                   `json:"start_time,omitempty"`
+	EndTime   int64                   `json:"end_time,omitempty"`
+	Count     int                     `json:"count,omitempty"`
+	Output    string                  `json:"output"`
+	Logs      int                     `json:"logs"`
+	Config    logshare.ConfigSnapshot `json:"config"`
+}
+
+// writeSidecar writes s as indented JSON to the named Google Storage object
+// when bucket is set, or to the named local file otherwise, returning where it
+// was written.
+func writeSidecar(s sidecar, bucket string, name string, credentialsFile string) (string, error) {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	data = append(data, '\n')
+
+	if bucket == "" {
+		return name, errors.Wrap(ioutil.WriteFile(name, data, 0644), "failed to write config sidecar")
+	}
+
+	w, err := setupGoogleStr("", bucket, name, true, credentialsFile)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return "", errors.Wrap(err, "failed to upload config sidecar")
+	}
+
+	return "gs://" + bucket + "/" + name, errors.Wrap(w.Close(), "failed to upload config sidecar")
+}
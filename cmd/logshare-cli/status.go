@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cloudflare/logshare"
+)
+
+// statusField is the log field --status-summary tallies.
+const statusField = "EdgeResponseStatus"
+
+// statusValues is the number of distinct statuses counted. Statuses have
+// three digits, so every one of them is counted exactly.
+const statusValues = 1000
+
+// statusTally counts logs by the class (2xx, 3xx...) of their edge response
+// status. The client writes each log to it in a single call as a line of JSON.
+type statusTally struct {
+	logs     int
+	statuses *logshare.ValueCounter
+}
+
+func newStatusTally() *statusTally {
+	return &statusTally{statuses: logshare.NewValueCounter(statusField, statusValues)}
+}
+
+func (t *statusTally) Write(p []byte) (int, error) {
+	t.logs++
+	// Logs that cannot be decoded are counted as other, rather than failing
+	// the pull over a summary.
+	t.statuses.Add(p)
+
+	return len(p), nil
+}
+
+// classes returns the counts of logs indexed by the first digit of their
+// status, with other statuses (or logs without one) at index 0.
+func (t *statusTally) classes() [6]int {
+	var classes [6]int
+	counted := 0
+	for _, status := range t.statuses.Top() {
+		if code, err := strconv.Atoi(status.Value); err == nil && code/100 >= 1 && code/100 <= 5 {
+			classes[code/100] += status.Count
+			counted += status.Count
+		}
+	}
+	classes[0] = t.logs - counted
+
+	return classes
+}
+
+// String returns a summary such as "2xx=10 3xx=2 4xx=1 5xx=0". 1xx and other
+// statuses are only included when seen.
+func (t *statusTally) String() string {
+	classes := t.classes()
+	var parts []string
+	if classes[1] > 0 {
+		parts = append(parts, fmt.Sprintf("1xx=%d", classes[1]))
+	}
+	for class := 2; class <= 5; class++ {
+		parts = append(parts, fmt.Sprintf("%dxx=%d", class, classes[class]))
+	}
+	if classes[0] > 0 {
+		parts = append(parts, fmt.Sprintf("other=%d", classes[0]))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// hasField reports whether field is among fields.
+func hasField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestStatusTally(t *testing.T) {
+	tally := newStatusTally()
+	for _, log := range []string{
+		`{"EdgeResponseStatus":200}`,
+		`{"EdgeResponseStatus":204}`,
+		`{"EdgeResponseStatus":301}`,
+		`{"EdgeResponseStatus":503}`,
+		`{"RayID":"ray"}`,
+		`not json`,
+	} {
+		tally.Write([]byte(log + "\n"))
+	}
+
+	if got, want := tally.String(), "2xx=2 3xx=1 4xx=0 5xx=1 other=2"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// zoneIDPattern matches a zone ID, as opposed to a zone name.
+var zoneIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// readZoneFile reads the zones listed in path, one zone ID or name per line.
+// Blank lines and lines starting with '#' are ignored.
+func readZoneFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open zone-file")
+	}
+	defer f.Close()
+
+	var zones []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		zones = append(zones, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read zone-file")
+	}
+
+	if len(zones) == 0 {
+		return nil, errors.Errorf("zone-file %s lists no zones", path)
+	}
+
+	return zones, nil
+}
+
+// pullZones pulls the same logs for each zone listed in conf.zoneFile in turn,
+// continuing past failures, and then summarizes the results. Each zone's logs
+// go to their own file or object, since output names include the zone ID. It
+// returns an error if any zone failed.
+func pullZones(conf *config) error {
+	zones, err := readZoneFile(conf.zoneFile)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, zone := range zones {
+		zoneConf := *conf
+		zoneConf.zoneID, zoneConf.zoneName = zone, ""
+
+		err := func() error {
+			if !zoneIDPattern.MatchString(zone) {
+				if conf.apiToken != "" {
+					return errors.New("zone names cannot be looked up with api-token; list zone IDs instead")
+				}
+
+				id, err := zoneIDByName(conf, zone)
+				if err != nil {
+					return err
+				}
+				zoneConf.zoneID = id
+			}
+
+			log.Printf("Pulling zone %s", zone)
+			return pull(&zoneConf)
+		}()
+		if err != nil {
+			log.Printf("Zone %s failed: %v", zone, err)
+			failed = append(failed, zone)
+		}
+	}
+
+	log.Printf("Pulled %d of %d zones successfully", len(zones)-len(failed), len(zones))
+	if len(failed) > 0 {
+		return errors.Errorf("%d of %d zones failed: %s", len(failed), len(zones), strings.Join(failed, ", "))
+	}
+
+	return nil
+}
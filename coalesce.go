@@ -0,0 +1,70 @@
+package logshare
+
+import (
+	"context"
+	"net/url"
+)
+
+// flightResult is the buffered response of a coalesced request.
+type flightResult struct {
+	meta *Meta
+	// The logs read, as split by the leader. They are shared between the
+	// waiters and must not be modified.
+	logs [][]byte
+}
+
+// coalescedRequest performs a request shared with any identical requests
+// already in flight, then replays the logs read to fn.
+func (c *Client) coalescedRequest(ctx context.Context, u *url.URL, fn func(log []byte) error) (*Meta, error) {
+	key := c.apiEmail + "\x00" + c.apiKey + "\x00" + c.apiToken + "\x00" + u.String()
+
+	v, err, _ := c.flight.Do(key, func() (interface{}, error) {
+		var logs [][]byte
+		meta, err := c.doRequest(ctx, u, func(log []byte) error {
+			// The scanner reuses its buffer, so each log must be copied.
+			logs = append(logs, append([]byte(nil), log...))
+			return nil
+		})
+		return &flightResult{meta: meta, logs: logs}, err
+	})
+
+	res := v.(*flightResult)
+	if res.meta == nil {
+		return nil, err
+	}
+
+	// Callers may modify the returned Meta, so each gets its own copy.
+	meta := *res.meta
+	if err != nil {
+		return &meta, err
+	}
+
+	s, err := replayLogs(ctx, res.logs, fn)
+	s.record(&meta)
+	return &meta, err
+}
+
+// replayLogs calls fn for each of logs, counting them as streamLogs does.
+// Replaying stops at the first error returned by fn, other than errSkipLog, or
+// once ctx is cancelled.
+func replayLogs(ctx context.Context, logs [][]byte, fn func(log []byte) error) (streamed, error) {
+	var s streamed
+	for _, log := range logs {
+		if err := ctx.Err(); err != nil {
+			s.incomplete = true
+			return s, err
+		}
+
+		s.scanned++
+		s.bytes += int64(len(log)) + 1
+
+		if err := fn(log); err == errSkipLog {
+			continue
+		} else if err != nil {
+			return s, err
+		}
+		s.count++
+	}
+
+	return s, nil
+}
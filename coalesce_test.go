@@ -0,0 +1,71 @@
+package logshare
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalesceRequests(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		fmt.Fprint(w, "{}\n{}\n")
+	}))
+	defer ts.Close()
+
+	client, err := New("key", "email", &Options{ApiURL: ts.URL + "/", CoalesceRequests: true, Dest: NewSyncWriter(&bytes.Buffer{})})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Concurrent handlers share one Client.
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			meta, err := client.GetFromTimestamp("zone", 1, 2, 0)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if meta.Count != 2 {
+				t.Errorf("got Count %d, want 2", meta.Count)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+}
+
+func TestCoalesceRequestsSplitFunc(t *testing.T) {
+	ts := newTestServer(t, "\x1e{\"a\":1}\n\x1e{\"a\":2}\n")
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	client, err := New("key", "email", &Options{ApiURL: ts.URL + "/", CoalesceRequests: true, SplitFunc: ScanRecords, Dest: &buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := client.GetFromTimestamp("zone", 1, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Count != 2 {
+		t.Errorf("got Count %d, want 2", meta.Count)
+	}
+	if want := "{\"a\":1}\n{\"a\":2}\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
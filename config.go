@@ -0,0 +1,104 @@
+package logshare
+
+import (
+	"net/http"
+	"sort"
+	"time"
+)
+
+// ConfigSnapshot is the resolved configuration of a Client, suitable for
+// archiving alongside the logs it fetched. Credentials are never included, and
+// only the names of custom headers are recorded since their values may be
+// secret.
+type ConfigSnapshot struct {
+	Endpoint          string              `json:"endpoint"`
+	APIEmail          string              `json:"api_email"`
+	Fields            []string            `json:"fields,omitempty"`
+	FieldsByZone      map[string][]string `json:"fields_by_zone,omitempty"`
+	FieldAliases      map[string]string   `json:"field_aliases,omitempty"`
+	Sample            float64             `json:"sample,omitempty"`
+	TimestampFormat   TimestampFormat     `json:"timestamp_format,omitempty"`
+	Format            OutputFormat        `json:"format"`
+	CanonicalizeKeys  bool                `json:"canonicalize_keys,omitempty"`
+	SequenceField     string              `json:"sequence_field,omitempty"`
+	PartitionField    string              `json:"partition_field,omitempty"`
+	Encrypted         bool                `json:"encrypted,omitempty"`
+	Compressed        bool                `json:"compressed,omitempty"`
+	ForceRequest      bool                `json:"force_request,omitempty"`
+	StrictContentType bool                `json:"strict_content_type,omitempty"`
+	CoalesceRequests  bool                `json:"coalesce_requests,omitempty"`
+	AdaptiveWindow    bool                `json:"adaptive_window,omitempty"`
+	TreatEmptyAsError bool                `json:"treat_empty_as_error,omitempty"`
+	// Window bounds and the retention window, in seconds.
+	MinWindow       int64 `json:"min_window,omitempty"`
+	MaxWindow       int64 `json:"max_window,omitempty"`
+	RetentionWindow int64 `json:"retention_window,omitempty"`
+	// The write throttle, in bytes per second.
+	ThrottleWrites int64    `json:"throttle_writes,omitempty"`
+	HeaderNames    []string `json:"header_names,omitempty"`
+}
+
+// Config returns a snapshot of the client's effective configuration, with
+// defaults applied and secrets omitted.
+func (c *Client) Config() ConfigSnapshot {
+	snapshot := ConfigSnapshot{
+		Endpoint:          c.endpoint,
+		APIEmail:          c.apiEmail,
+		Fields:            append([]string(nil), c.fields...),
+		Sample:            c.sample,
+		TimestampFormat:   c.timestampFormat,
+		Format:            c.format,
+		CanonicalizeKeys:  c.canonicalize,
+		SequenceField:     c.sequenceField,
+		Encrypted:         c.encrypted,
+		Compressed:        c.compressed,
+		ForceRequest:      c.forceRequest,
+		StrictContentType: c.strictCT,
+		CoalesceRequests:  c.flight != nil,
+		AdaptiveWindow:    c.adaptiveWindow,
+		TreatEmptyAsError: c.emptyAsError,
+		MinWindow:         int64(c.minWindow / time.Second),
+		MaxWindow:         int64(c.maxWindow / time.Second),
+		RetentionWindow:   int64(c.retentionWindow / time.Second),
+		HeaderNames:       headerNames(c.headers),
+	}
+
+	if len(c.fieldsByZone) > 0 {
+		snapshot.FieldsByZone = make(map[string][]string, len(c.fieldsByZone))
+		for zoneID, fields := range c.fieldsByZone {
+			snapshot.FieldsByZone[zoneID] = append([]string(nil), fields...)
+		}
+	}
+
+	if len(c.fieldAliases) > 0 {
+		snapshot.FieldAliases = make(map[string]string, len(c.fieldAliases))
+		for field, alias := range c.fieldAliases {
+			snapshot.FieldAliases[field] = alias
+		}
+	}
+
+	if c.partitioner != nil {
+		snapshot.PartitionField = c.partitioner.field
+	}
+
+	if c.throttle != nil {
+		snapshot.ThrottleWrites = c.throttle.rate
+	}
+
+	return snapshot
+}
+
+// headerNames returns the sorted, canonical names of the headers in h.
+func headerNames(h http.Header) []string {
+	if len(h) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
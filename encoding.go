@@ -0,0 +1,59 @@
+package logshare
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// bodyDecoders decode response bodies by their Content-Encoding.
+var bodyDecoders = map[string]func(r io.Reader) (io.ReadCloser, error){
+	"gzip": func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+}
+
+// acceptEncodings are the compressed encodings requested with Options.Gzip,
+// in order of preference.
+var acceptEncodings = []string{"gzip"}
+
+// contentEncoding returns the normalized Content-Encoding of resp, or "" for
+// an identity (uncompressed) response.
+func contentEncoding(resp *http.Response) string {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding == "identity" {
+		return ""
+	}
+
+	return encoding
+}
+
+// decodeBody returns a reader for the decoded body of resp, according to its
+// Content-Encoding. The caller must close it, and should check the error from
+// Close, which reports any problem the decoder found.
+func decodeBody(resp *http.Response) (io.ReadCloser, error) {
+	encoding := contentEncoding(resp)
+	if encoding == "" {
+		return ioutil.NopCloser(resp.Body), nil
+	}
+
+	decode, ok := bodyDecoders[encoding]
+	if !ok {
+		return nil, errors.Errorf("unsupported Content-Encoding %q", encoding)
+	}
+
+	body, err := decode(resp.Body)
+	if err == io.EOF {
+		// An empty body has no compression header to read.
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode %s response", encoding)
+	}
+
+	return body, nil
+}
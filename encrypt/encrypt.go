@@ -0,0 +1,260 @@
+// Package encrypt implements streaming AES-256-GCM encryption for log output.
+//
+// A stream starts with a header holding a magic string and a random nonce
+// prefix, followed by length-prefixed chunks of up to 64KiB of plaintext, each
+// sealed with AES-GCM. Each chunk's nonce combines the prefix, the chunk's
+// index and a flag marking the final chunk, so reordered, dropped or truncated
+// chunks are detected when decrypting.
+package encrypt
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// KeySize is the required key length, in bytes (AES-256).
+	KeySize = 32
+
+	magic      = "LSE1"
+	prefixSize = 7
+	headerSize = len(magic) + prefixSize
+	chunkSize  = 64 * 1024
+)
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, errors.Errorf("encryption key must be %d bytes, got %d", KeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// nonce fills n with the nonce for the chunk at index i.
+func nonce(n []byte, prefix []byte, i uint32, last bool) {
+	copy(n, prefix)
+	binary.BigEndian.PutUint32(n[prefixSize:], i)
+	n[len(n)-1] = 0
+	if last {
+		n[len(n)-1] = 1
+	}
+}
+
+// Writer encrypts data written to it. Close must be called to write the final
+// chunk; a stream that was not closed fails to decrypt.
+type Writer struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	prefix []byte
+	nonce  []byte
+	buf    []byte
+	out    []byte
+	index  uint32
+	header bool
+	closed bool
+}
+
+// NewWriter returns a Writer encrypting to w with the given 32-byte key.
+func NewWriter(w io.Writer, key []byte) (*Writer, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, prefixSize)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return nil, errors.Wrap(err, "failed to generate nonce")
+	}
+
+	return &Writer{
+		w:      w,
+		aead:   aead,
+		prefix: prefix,
+		nonce:  make([]byte, aead.NonceSize()),
+		buf:    make([]byte, 0, chunkSize),
+		out:    make([]byte, 4, 4+chunkSize+aead.Overhead()),
+	}, nil
+}
+
+// Write buffers p, encrypting and writing each full chunk.
+func (ew *Writer) Write(p []byte) (int, error) {
+	if ew.closed {
+		return 0, errors.New("write to closed encrypt.Writer")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		// Only seal a full chunk once more data arrives, so that the final
+		// chunk is always written by Close.
+		if len(ew.buf) == chunkSize {
+			if err := ew.seal(false); err != nil {
+				return written, err
+			}
+		}
+
+		n := copy(ew.buf[len(ew.buf):chunkSize], p)
+		ew.buf = ew.buf[:len(ew.buf)+n]
+		p = p[n:]
+		written += n
+	}
+
+	return written, nil
+}
+
+// Close encrypts and writes the final chunk. It does not close the underlying
+// writer.
+func (ew *Writer) Close() error {
+	if ew.closed {
+		return nil
+	}
+	ew.closed = true
+
+	return ew.seal(true)
+}
+
+func (ew *Writer) seal(last bool) error {
+	if !ew.header {
+		if _, err := io.WriteString(ew.w, magic); err != nil {
+			return err
+		}
+		if _, err := ew.w.Write(ew.prefix); err != nil {
+			return err
+		}
+		ew.header = true
+	}
+
+	if ew.index == math.MaxUint32 {
+		return errors.New("encrypted stream is too long")
+	}
+
+	nonce(ew.nonce, ew.prefix, ew.index, last)
+	ew.out = ew.aead.Seal(ew.out[:4], ew.nonce, ew.buf, nil)
+	binary.BigEndian.PutUint32(ew.out[:4], uint32(len(ew.out)-4))
+
+	if _, err := ew.w.Write(ew.out); err != nil {
+		return err
+	}
+
+	ew.buf = ew.buf[:0]
+	ew.index++
+	return nil
+}
+
+// Reader decrypts a stream written by Writer.
+type Reader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	nonce  []byte
+	in     []byte
+	plain  []byte
+	index  uint32
+	header bool
+	done   bool
+	err    error
+}
+
+// NewReader returns a Reader decrypting from r with the given 32-byte key.
+func NewReader(r io.Reader, key []byte) (*Reader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reader{
+		r:      bufio.NewReader(r),
+		aead:   aead,
+		prefix: make([]byte, prefixSize),
+		nonce:  make([]byte, aead.NonceSize()),
+	}, nil
+}
+
+// Read reads decrypted data. It returns an error if the stream was tampered
+// with, encrypted with a different key, or truncated.
+func (er *Reader) Read(p []byte) (int, error) {
+	for len(er.plain) == 0 {
+		if er.err != nil {
+			return 0, er.err
+		}
+		er.err = er.next()
+	}
+
+	n := copy(p, er.plain)
+	er.plain = er.plain[n:]
+	return n, nil
+}
+
+// next decrypts the next chunk into er.plain.
+func (er *Reader) next() error {
+	if !er.header {
+		header := make([]byte, headerSize)
+		if _, err := io.ReadFull(er.r, header); err != nil {
+			return errors.Wrap(unexpectedEOF(err), "failed to read header")
+		}
+
+		if string(header[:len(magic)]) != magic {
+			return errors.New("not an encrypted log stream")
+		}
+
+		copy(er.prefix, header[len(magic):])
+		er.header = true
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(er.r, size[:]); err != nil {
+		if err == io.EOF && er.done {
+			return io.EOF
+		}
+		return errors.Wrap(unexpectedEOF(err), "failed to read chunk")
+	}
+
+	if er.done {
+		return errors.New("data found after the final chunk")
+	}
+
+	n := binary.BigEndian.Uint32(size[:])
+	if n > chunkSize+uint32(er.aead.Overhead()) {
+		return errors.Errorf("chunk of %d bytes is too large", n)
+	}
+
+	if cap(er.in) < int(n) {
+		er.in = make([]byte, n)
+	}
+	er.in = er.in[:n]
+	if _, err := io.ReadFull(er.r, er.in); err != nil {
+		return errors.Wrap(unexpectedEOF(err), "failed to read chunk")
+	}
+
+	var err error
+	nonce(er.nonce, er.prefix, er.index, false)
+	er.plain, err = er.aead.Open(er.plain[:0], er.nonce, er.in, nil)
+	if err != nil {
+		nonce(er.nonce, er.prefix, er.index, true)
+		if er.plain, err = er.aead.Open(er.plain[:0], er.nonce, er.in, nil); err != nil {
+			return errors.New("failed to decrypt chunk: wrong key or corrupted data")
+		}
+		er.done = true
+	}
+
+	er.index++
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
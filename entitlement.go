@@ -0,0 +1,144 @@
+package logshare
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// entitlementMemo records the result of probing zones for Log Share, so that
+// repeated pulls for zones without it fail fast instead of waiting on a 204
+// each time, and empty windows of zones with it are not probed again. It is
+// safe for concurrent use.
+type entitlementMemo struct {
+	mu sync.Mutex
+	// Whether each probed zone has Log Share enabled.
+	zones map[string]bool
+}
+
+func newEntitlementMemo() *entitlementMemo {
+	return &entitlementMemo{zones: make(map[string]bool)}
+}
+
+// lookup returns whether the zone has Log Share enabled, and whether that is
+// known.
+func (m *entitlementMemo) lookup(zoneID string) (entitled bool, known bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entitled, known = m.zones[zoneID]
+	return entitled, known
+}
+
+func (m *entitlementMemo) set(zoneID string, entitled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.zones[zoneID] = entitled
+}
+
+func (m *entitlementMemo) reset(zoneID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if zoneID == "" {
+		m.zones = make(map[string]bool)
+		return
+	}
+	delete(m.zones, zoneID)
+}
+
+// ResetEntitlement forgets whether the given zone was found to have Log Share
+// enabled, so that the next request for it is sent to the API and probed
+// again. Pass an empty zoneID to forget all zones.
+//
+// When a log request returns 204 No Content, a follow-up probe of the zone's
+// fields endpoint tells whether Log Share is unavailable. The result is
+// remembered for the lifetime of the Client: requests for a zone without Log
+// Share return ErrNotEntitled without contacting the API unless
+// Options.ForceRequest is set, and later 204s for a zone with it are not
+// probed again. A probe that fails is not remembered, and is not retried
+// until the next call. A probe refused with 401 or 403 fails the call with the
+// API error, as the credentials cannot read the zone's logs.
+func (c *Client) ResetEntitlement(zoneID string) {
+	c.entitlement.reset(zoneID)
+}
+
+// zoneRequest performs a request for logs from zoneID, short-circuiting zones
+// previously found not to have Log Share enabled.
+func (c *call) zoneRequest(ctx context.Context, zoneID string, u *url.URL, fn func(log []byte) error) (*Meta, error) {
+	if entitled, known := c.entitlement.lookup(zoneID); known && !entitled && !c.forceRequest {
+		return nil, wrapf(ErrNotEntitled, "zone %s (remembered from an earlier request, see ResetEntitlement)", zoneID)
+	}
+
+	meta, err := c.request(ctx, u, fn)
+	if meta != nil && meta.StatusCode == http.StatusNoContent {
+		if perr := c.probeEntitlement(ctx, zoneID); perr != nil {
+			return nil, perr
+		}
+		if entitled, known := c.entitlement.lookup(zoneID); known && !entitled {
+			err = wrapf(ErrNotEntitled, "zone %s", zoneID)
+		}
+	}
+
+	return meta, err
+}
+
+// isNotEntitled reports whether err wraps ErrNotEntitled.
+func isNotEntitled(err error) bool {
+	for err != nil {
+		if err == ErrNotEntitled {
+			return true
+		}
+		cause, ok := err.(interface{ Cause() error })
+		if !ok {
+			return false
+		}
+		err = cause.Cause()
+	}
+
+	return false
+}
+
+// probeEntitlement probes the zone's fields endpoint to tell a 204 caused by
+// Log Share being disabled from one caused by an empty or too recent window,
+// unless the zone's result is already known or it was probed earlier in the
+// call. Only an answer from the endpoint itself is remembered: 200 OK means
+// Log Share is enabled, and 204 No Content that it is not. A 401 or 403 means
+// the credentials may not read the zone's logs, which says nothing of Log
+// Share, and is returned as an error.
+func (c *call) probeEntitlement(ctx context.Context, zoneID string) error {
+	if _, known := c.entitlement.lookup(zoneID); known {
+		return nil
+	}
+
+	c.mu.Lock()
+	probed := c.probed[zoneID]
+	if c.probed == nil {
+		c.probed = make(map[string]bool)
+	}
+	c.probed[zoneID] = true
+	c.mu.Unlock()
+	if probed {
+		return nil
+	}
+
+	u, err := c.fieldsURL(zoneID)
+	if err != nil {
+		return nil
+	}
+
+	meta, err := c.request(ctx, u, func([]byte) error { return nil })
+	if meta == nil {
+		return nil
+	}
+
+	switch meta.StatusCode {
+	case http.StatusOK:
+		c.entitlement.set(zoneID, true)
+	case http.StatusNoContent:
+		c.entitlement.set(zoneID, false)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return wrapf(err, "the credentials are not authorized to read the logs of zone %s", zoneID)
+	}
+
+	return nil
+}
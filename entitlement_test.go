@@ -0,0 +1,129 @@
+package logshare
+
+import (
+	"context"
+	stderrors "errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// newEntitlementServer returns a server answering log requests with 204 No
+// Content, and probes of the fields endpoint with probeStatus, counting the
+// probes.
+func newEntitlementServer(probeStatus int, probes *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/fields") {
+			atomic.AddInt32(probes, 1)
+			w.WriteHeader(probeStatus)
+			if probeStatus == http.StatusOK {
+				w.Write([]byte("{}"))
+			}
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+func TestEntitlementProbedOnce(t *testing.T) {
+	var probes int32
+	ts := newEntitlementServer(http.StatusOK, &probes)
+	defer ts.Close()
+
+	client, err := New("key", "email", &Options{ApiURL: ts.URL + "/", Dest: ioutil.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetFromTimeRange("zone", 0, 180, time.Minute, 0); err != nil && errors.Cause(err) != ErrNoLogs {
+			t.Fatal(err)
+		}
+	}
+
+	if probes != 1 {
+		t.Errorf("got %d probes, want 1", probes)
+	}
+}
+
+func TestEntitlementNotEnabled(t *testing.T) {
+	var probes int32
+	ts := newEntitlementServer(http.StatusNoContent, &probes)
+	defer ts.Close()
+
+	client, err := New("key", "email", &Options{ApiURL: ts.URL + "/", Dest: ioutil.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := client.GetFromTimestamp("zone", 0, 60, 0)
+		if errors.Cause(err) != ErrNoLogs {
+			t.Fatalf("got error %v, want ErrNoLogs", err)
+		}
+	}
+	if probes != 1 {
+		t.Errorf("got %d probes, want 1", probes)
+	}
+
+	client.ResetEntitlement("zone")
+	client.GetFromTimestamp("zone", 0, 60, 0)
+	if probes != 2 {
+		t.Errorf("got %d probes after ResetEntitlement, want 2", probes)
+	}
+}
+
+func TestEntitlementForbidden(t *testing.T) {
+	var probes int32
+	ts := newEntitlementServer(http.StatusForbidden, &probes)
+	defer ts.Close()
+
+	client, err := New("key", "email", &Options{ApiURL: ts.URL + "/", Dest: ioutil.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A 403 is a credentials problem rather than proof that the zone lacks
+	// Log Share, so it is reported and not remembered.
+	for i := 0; i < 2; i++ {
+		_, err := client.GetFromTimestamp("zone", 0, 60, 0)
+		var apiErr *APIError
+		if !stderrors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+			t.Fatalf("call %d: got error %v, want a 403 APIError", i, err)
+		}
+	}
+	if probes != 2 {
+		t.Errorf("got %d probes, want one per call", probes)
+	}
+}
+
+func TestTailNotEntitled(t *testing.T) {
+	var probes int32
+	ts := newEntitlementServer(http.StatusNoContent, &probes)
+	defer ts.Close()
+
+	client, err := New("key", "email", &Options{ApiURL: ts.URL + "/", Dest: ioutil.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Once a zone is known not to have Log Share, tailing it fails rather
+	// than polling forever, whether it was found before or during the tail.
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := client.Tail(ctx, "zone", minEndAge, 10*time.Millisecond)
+		cancel()
+		if !stderrors.Is(err, ErrNotEntitled) {
+			t.Fatalf("tail %d: got error %v, want ErrNotEntitled", i, err)
+		}
+		if errors.Cause(err) != ErrNoLogs {
+			t.Errorf("tail %d: got error %v, want it to wrap ErrNoLogs", i, err)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package logshare
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// fieldCache caches the available field listings of zones. It is safe for
+// concurrent use.
+type fieldCache struct {
+	mu    sync.Mutex
+	zones map[string]map[string]string
+}
+
+func newFieldCache() *fieldCache {
+	return &fieldCache{zones: make(map[string]map[string]string)}
+}
+
+func (fc *fieldCache) get(zoneID string) (map[string]string, bool) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fields, ok := fc.zones[zoneID]
+	return fields, ok
+}
+
+func (fc *fieldCache) set(zoneID string, fields map[string]string) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.zones[zoneID] = fields
+}
+
+// ListFields returns the log fields available to the zone, mapped to their
+// descriptions. Listings are cached for the lifetime of the Client, so only
+// the first call for a zone contacts the API.
+func (c *Client) ListFields(zoneID string) (map[string]string, error) {
+	if fields, ok := c.fieldCache.get(zoneID); ok {
+		return fields, nil
+	}
+
+	fields, _, err := c.fieldNames(context.Background(), zoneID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.fieldCache.set(zoneID, fields)
+	return fields, nil
+}
+
+// ListFieldNames fetches the log fields available to the zone, returning a map
+// of field names to their descriptions. Unlike ListFields it always makes a
+// request, and Meta.Count is the number of fields.
+func (c *Client) ListFieldNames(zoneID string) (map[string]string, *Meta, error) {
+	cl := c.startCall()
+	fields, meta, err := c.fieldNames(context.Background(), zoneID)
+	meta, err = cl.finish(meta, err)
+	if err != nil {
+		return nil, meta, err
+	}
+
+	c.fieldCache.set(zoneID, fields)
+	return fields, meta, nil
+}
+
+// fieldNames requests and decodes the fields endpoint for the zone.
+func (c *Client) fieldNames(ctx context.Context, zoneID string) (map[string]string, *Meta, error) {
+	u, err := c.fieldsURL(zoneID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var body bytes.Buffer
+	meta, err := c.request(ctx, u, func(line []byte) error {
+		body.Write(line)
+		body.WriteByte('\n')
+		return nil
+	})
+	if err != nil {
+		return nil, meta, err
+	}
+
+	var fields map[string]string
+	if err := json.Unmarshal(body.Bytes(), &fields); err != nil {
+		return nil, meta, errors.Wrap(err, "failed to decode field names")
+	}
+	meta.Count = len(fields)
+
+	return fields, meta, nil
+}
+
+// ValidateFields checks the fields the client requests for the zone against
+// those available to it, returning an error that lists any unknown fields
+// along with the closest available names, e.g. ClientIP for ClientIp.
+func (c *Client) ValidateFields(zoneID string) error {
+	requested := c.fieldsFor(zoneID)
+	if len(requested) == 0 {
+		return nil
+	}
+
+	available, err := c.ListFields(zoneID)
+	if err != nil {
+		return errors.Wrap(err, "failed to list fields")
+	}
+
+	var problems []string
+	for _, field := range requested {
+		if _, ok := available[field]; ok {
+			continue
+		}
+
+		if suggestions := suggestFields(field, available); len(suggestions) > 0 {
+			problems = append(problems, fmt.Sprintf("%q (did you mean %s?)", field, strings.Join(suggestions, " or ")))
+		} else {
+			problems = append(problems, fmt.Sprintf("%q", field))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.Errorf("unknown fields for zone %s: %s", zoneID, strings.Join(problems, ", "))
+	}
+
+	return nil
+}
+
+// maxSuggestionDistance is the largest edit distance at which an available
+// field is suggested for an unknown one.
+const maxSuggestionDistance = 2
+
+// suggestFields returns the sorted available fields closest to field: those
+// equal to it ignoring case, or failing that those within
+// maxSuggestionDistance edits of it.
+func suggestFields(field string, available map[string]string) []string {
+	var exact, near []string
+	for name := range available {
+		switch {
+		case strings.EqualFold(name, field):
+			exact = append(exact, name)
+		case editDistance(strings.ToLower(name), strings.ToLower(field)) <= maxSuggestionDistance:
+			near = append(near, name)
+		}
+	}
+
+	if len(exact) > 0 {
+		sort.Strings(exact)
+		return exact
+	}
+	sort.Strings(near)
+
+	return near
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			cur[j] = prev[j-1] + cost
+			if d := prev[j] + 1; d < cur[j] {
+				cur[j] = d
+			}
+			if d := cur[j-1] + 1; d < cur[j] {
+				cur[j] = d
+			}
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+// DiffFields compares the log fields available to two zones, returning the
+// sorted names of the fields available only to zoneA and only to zoneB.
+func (c *Client) DiffFields(zoneA string, zoneB string) (onlyA []string, onlyB []string, err error) {
+	fieldsA, err := c.ListFields(zoneA)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to list fields for zone %s", zoneA)
+	}
+
+	fieldsB, err := c.ListFields(zoneB)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to list fields for zone %s", zoneB)
+	}
+
+	return difference(fieldsA, fieldsB), difference(fieldsB, fieldsA), nil
+}
+
+// difference returns the sorted keys of a that are not in b.
+func difference(a map[string]string, b map[string]string) []string {
+	var keys []string
+	for key := range a {
+		if _, ok := b[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
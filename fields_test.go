@@ -0,0 +1,81 @@
+package logshare
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newFieldsServer returns a server listing the given fields for each zone, and
+// failing for any other zone. The number of requests is counted in calls.
+func newFieldsServer(t *testing.T, zones map[string]string, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		for zone, fields := range zones {
+			if strings.Contains(r.URL.Path, "/zones/"+zone+"/") {
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprint(w, fields)
+				return
+			}
+		}
+		http.Error(w, `{"success":false,"errors":[{"code":1001,"message":"zone not found"}]}`, http.StatusNotFound)
+	}))
+}
+
+func TestDiffFields(t *testing.T) {
+	var calls int32
+	ts := newFieldsServer(t, map[string]string{
+		"a": "{\n  \"ClientIP\": \"Client IP\",\n  \"RayID\": \"Ray ID\",\n  \"WAFAction\": \"WAF action\"\n}\n",
+		"b": `{"RayID":"Ray ID","BotScore":"Bot score","CacheTieredFill":"Tiered fill"}`,
+	}, &calls)
+	defer ts.Close()
+
+	client, err := New("key", "email", &Options{ApiURL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	onlyA, onlyB, err := client.DiffFields("a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"ClientIP", "WAFAction"}; !reflect.DeepEqual(onlyA, want) {
+		t.Errorf("got only in a %v, want %v", onlyA, want)
+	}
+	if want := []string{"BotScore", "CacheTieredFill"}; !reflect.DeepEqual(onlyB, want) {
+		t.Errorf("got only in b %v, want %v", onlyB, want)
+	}
+
+	// Listings are cached, so comparing again makes no requests.
+	if _, _, err := client.DiffFields("b", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("got %d requests, want 2", n)
+	}
+
+	onlyA, onlyB, err = client.DiffFields("a", "a")
+	if err != nil || onlyA != nil || onlyB != nil {
+		t.Fatalf("comparing a zone with itself: got %v, %v, %v", onlyA, onlyB, err)
+	}
+}
+
+func TestDiffFieldsFailure(t *testing.T) {
+	var calls int32
+	ts := newFieldsServer(t, map[string]string{"a": `{"RayID":"Ray ID"}`}, &calls)
+	defer ts.Close()
+
+	client, err := New("key", "email", &Options{ApiURL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = client.DiffFields("a", "missing")
+	if err == nil || !strings.Contains(err.Error(), "zone missing") {
+		t.Fatalf("got %v, want an error naming the zone", err)
+	}
+}
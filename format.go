@@ -0,0 +1,269 @@
+package logshare
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// OutputFormat is the format logs are written to the destination in.
+type OutputFormat string
+
+const (
+	// FormatJSON writes logs as newline-delimited JSON, as returned by the
+	// API. This is the default.
+	FormatJSON OutputFormat = "json"
+	// FormatLogfmt writes each log as a line of logfmt key=value pairs. Keys
+	// are written in the order of Options.Fields, which must be set.
+	FormatLogfmt OutputFormat = "logfmt"
+	// FormatPretty writes each log as indented, multi-line JSON, for reading
+	// in a terminal. The output is not newline-delimited JSON.
+	FormatPretty OutputFormat = "pretty"
+	// FormatCSV writes logs as CSV, with a column for each of Options.Fields,
+	// which must be set, in that order. A header row naming the fields is
+	// written before the first log to each destination. Missing and null
+	// fields are written as empty cells, and nested objects and arrays as
+	// JSON.
+	FormatCSV OutputFormat = "csv"
+)
+
+// OutputSpec is a destination for logs and the format to write them in.
+type OutputSpec struct {
+	Writer io.Writer
+	// The format to write logs in. Defaults to Options.Format.
+	Format OutputFormat
+}
+
+// checkFormat returns an error if format is unknown, or cannot be used with
+// the requested fields.
+func checkFormat(format OutputFormat, fields []string) error {
+	switch format {
+	case FormatJSON, FormatPretty:
+		return nil
+	case FormatLogfmt, FormatCSV:
+		if len(fields) == 0 {
+			return errors.Errorf("Fields must be set to use the %s format", format)
+		}
+		return nil
+	default:
+		return errors.Errorf("unknown output format %q", format)
+	}
+}
+
+// render converts a JSON log to the given format.
+func (c *Client) render(log []byte, format OutputFormat) ([]byte, error) {
+	switch format {
+	case FormatLogfmt:
+		return formatLogfmt(log, c.columns)
+	case FormatCSV:
+		return formatCSV(log, c.columns)
+	case FormatPretty:
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, log, "", "  "); err != nil {
+			return nil, errors.Wrap(err, "failed to decode log")
+		}
+		return buf.Bytes(), nil
+	default:
+		return log, nil
+	}
+}
+
+// formatCSV converts a JSON log into a CSV row with a cell for each of fields,
+// in order, without a trailing newline.
+func formatCSV(log []byte, fields []string) ([]byte, error) {
+	var record map[string]json.RawMessage
+	if err := json.Unmarshal(log, &record); err != nil {
+		return nil, errors.Wrap(err, "failed to decode log")
+	}
+
+	row := make([]string, len(fields))
+	for i, field := range fields {
+		row[i] = csvCell(record[field])
+	}
+
+	return csvRow(row)
+}
+
+// csvCell returns the cell for a JSON value: strings unquoted, null or missing
+// values empty, and anything else as its JSON text.
+func csvCell(v json.RawMessage) string {
+	if len(v) == 0 || string(v) == "null" {
+		return ""
+	}
+
+	if v[0] == '"' {
+		var s string
+		if err := json.Unmarshal(v, &s); err == nil {
+			return s
+		}
+	}
+
+	return string(v)
+}
+
+// csvRow encodes a CSV row, quoting cells containing commas, quotes or
+// newlines, without a trailing newline.
+func csvRow(cells []string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(cells); err != nil {
+		return nil, err
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// csvHeaders records the destinations a CSV header row has been written to,
+// so that each gets exactly one.
+type csvHeaders struct {
+	mu      sync.Mutex
+	written map[csvDest]bool
+}
+
+// csvDest identifies a destination: an index into Options.MultiDest, or -1
+// for the client's destination, and the partition key with DestByKey.
+type csvDest struct {
+	output    int
+	partition string
+}
+
+func newCSVHeaders() *csvHeaders {
+	return &csvHeaders{written: make(map[csvDest]bool)}
+}
+
+// once calls write if dest has no header yet. The lock is held while writing,
+// so that concurrent writers to dest never write a row before the header.
+func (h *csvHeaders) once(dest csvDest, write func() error) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.written[dest] {
+		return nil
+	}
+
+	if err := write(); err != nil {
+		return err
+	}
+	h.written[dest] = true
+
+	return nil
+}
+
+// writeCSVHeader writes the header row to w if format is FormatCSV and dest
+// has no header yet.
+func (c *call) writeCSVHeader(w io.Writer, dest csvDest, format OutputFormat) error {
+	if format != FormatCSV {
+		return nil
+	}
+
+	return c.csvHeaders.once(dest, func() error {
+		header, err := csvRow(c.columns)
+		if err != nil {
+			return err
+		}
+
+		return c.writeLine(w, header)
+	})
+}
+
+// formatLogfmt converts a flat JSON log into a logfmt line. Keys listed in
+// order are written first, in that order, followed by any remaining keys in
+// sorted order. Nested objects and arrays are flattened into dotted keys, e.g.
+// {"a":{"b":1},"c":[2]} becomes a.b=1 c.0=2. Values containing spaces, quotes,
+// '=' or control characters are quoted; null values are written as empty.
+func formatLogfmt(log []byte, order []string) ([]byte, error) {
+	var record map[string]interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(log))
+	dec.UseNumber()
+	if err := dec.Decode(&record); err != nil {
+		return nil, errors.Wrap(err, "failed to decode log")
+	}
+
+	var buf bytes.Buffer
+	written := make(map[string]bool, len(record))
+
+	for _, key := range order {
+		if v, ok := record[key]; ok && !written[key] {
+			writeLogfmtValue(&buf, key, v)
+			written[key] = true
+		}
+	}
+
+	rest := make([]string, 0, len(record))
+	for key := range record {
+		if !written[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+
+	for _, key := range rest {
+		writeLogfmtValue(&buf, key, record[key])
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeLogfmtValue appends key=value pairs for v to buf, flattening nested
+// objects and arrays.
+func writeLogfmtValue(buf *bytes.Buffer, key string, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			writeLogfmtValue(buf, key+"."+k, v[k])
+		}
+	case []interface{}:
+		for i, elem := range v {
+			writeLogfmtValue(buf, key+"."+strconv.Itoa(i), elem)
+		}
+	default:
+		if buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		buf.WriteString(logfmtValue(v))
+	}
+}
+
+// logfmtValue renders a scalar JSON value, quoting it where required.
+func logfmtValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	case string:
+		if v == "" || strings.IndexFunc(v, needsQuote) >= 0 {
+			return strconv.Quote(v)
+		}
+		return v
+	default:
+		return ""
+	}
+}
+
+func needsQuote(r rune) bool {
+	return r <= ' ' || r == '=' || r == '"' || r == 0x7f
+}
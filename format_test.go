@@ -0,0 +1,59 @@
+package logshare
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFormatLogfmt(t *testing.T) {
+	tests := []struct {
+		log   string
+		order []string
+		want  string
+	}{
+		{`{"b":1,"a":"x"}`, nil, `a=x b=1`},
+		{`{"b":1,"a":"x"}`, []string{"b", "a"}, `b=1 a=x`},
+		{`{"a":{"z":1.50,"y":"<x> y"},"c":null}`, nil, `a.y="<x> y" a.z=1.50 c=`},
+		{`{"d":"","e":["q",2],"f":true}`, []string{"f"}, `f=true d="" e.0=q e.1=2`},
+		{`{"q":"say \"hi\"","eq":"a=b"}`, nil, `eq="a=b" q="say \"hi\""`},
+	}
+
+	for _, tt := range tests {
+		got, err := formatLogfmt([]byte(tt.log), tt.order)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.log, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.log, got, tt.want)
+		}
+	}
+}
+
+func TestFormatLogfmtOption(t *testing.T) {
+	ts := newTestServer(t, "{\"EdgeStartTimestamp\":1,\"ClientIP\":\"192.0.2.1\"}\n")
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	client, err := New("key", "email", &Options{
+		ApiURL: ts.URL,
+		Dest:   &buf,
+		Format: FormatLogfmt,
+		Fields: []string{"ClientIP", "EdgeStartTimestamp"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetFromTimestamp("zone", 1, 2, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "ClientIP=192.0.2.1 EdgeStartTimestamp=1\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+
+	// Without Fields, there is no order to write the keys in.
+	if _, err := New("key", "email", &Options{Format: FormatLogfmt}); err == nil {
+		t.Fatal("expected an error for FormatLogfmt without Fields")
+	}
+}
@@ -0,0 +1,74 @@
+package logshare
+
+import (
+	"compress/gzip"
+	"io"
+	"sync"
+	"time"
+)
+
+// gzipWriter compresses logs written to it, optionally flushing at an
+// interval so that a live consumer receives data before the stream is closed.
+type gzipWriter struct {
+	mu sync.Mutex
+	gz *gzip.Writer
+	// Whether anything has been written since the last flush.
+	dirty bool
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// newGzipWriter returns a gzipWriter writing to w, which flushes every
+// interval if interval > 0.
+func newGzipWriter(w io.Writer, interval time.Duration) *gzipWriter {
+	g := &gzipWriter{gz: gzip.NewWriter(w)}
+	if interval > 0 {
+		g.stop = make(chan struct{})
+		g.done = make(chan struct{})
+		go g.flushEvery(interval)
+	}
+
+	return g
+}
+
+func (g *gzipWriter) Write(p []byte) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.dirty = true
+	return g.gz.Write(p)
+}
+
+// Close stops any periodic flushing and writes the gzip footer. It does not
+// close the underlying writer.
+func (g *gzipWriter) Close() error {
+	if g.stop != nil {
+		close(g.stop)
+		<-g.done
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.gz.Close()
+}
+
+func (g *gzipWriter) flushEvery(interval time.Duration) {
+	defer close(g.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+			g.mu.Lock()
+			if g.dirty {
+				// A failed flush surfaces from the next Write or Close.
+				g.gz.Flush()
+				g.dirty = false
+			}
+			g.mu.Unlock()
+		}
+	}
+}
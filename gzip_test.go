@@ -0,0 +1,87 @@
+package logshare
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer that can be read while another goroutine
+// writes to it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// gunzip decompresses what has been written so far, ignoring a missing
+// footer.
+func (b *syncBuffer) gunzip() (string, error) {
+	b.mu.Lock()
+	data := append([]byte(nil), b.buf.Bytes()...)
+	b.mu.Unlock()
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	out, err := ioutil.ReadAll(zr)
+	return string(out), err
+}
+
+func TestGzipFlushInterval(t *testing.T) {
+	buf := &syncBuffer{}
+	g := newGzipWriter(buf, 10*time.Millisecond)
+	if _, err := g.Write([]byte("{\"a\":1}\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if out, _ := buf.gunzip(); out == "{\"a\":1}\n" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("logs were not readable before Close")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := g.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if out, err := buf.gunzip(); err != nil || out != "{\"a\":1}\n" {
+		t.Fatalf("got %q, %v after Close", out, err)
+	}
+}
+
+func TestGzipNoFlushInterval(t *testing.T) {
+	var buf bytes.Buffer
+	g := newGzipWriter(&buf, 0)
+	if _, err := g.Write([]byte("{\"a\":1}\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+	if err == nil {
+		if out, _ := ioutil.ReadAll(zr); len(out) > 0 {
+			t.Fatalf("got %q before Close without a flush interval", out)
+		}
+	} else if err != io.EOF && err != io.ErrUnexpectedEOF {
+		t.Fatal(err)
+	}
+
+	if err := g.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
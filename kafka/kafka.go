@@ -0,0 +1,169 @@
+// Package kafka produces logs fetched by a logshare.Client to a Kafka topic.
+//
+//	w := kafka.NewWriter([]string{"localhost:9092"}, "cloudflare-logs")
+//	defer w.Close()
+//	client, err := logshare.New(apiKey, apiEmail, &logshare.Options{
+//		MultiDest: []logshare.OutputSpec{{Writer: w}},
+//	})
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+const (
+	defaultBatchSize    = 100
+	defaultBatchTimeout = 10 * time.Millisecond
+)
+
+// Writer is an io.Writer that produces each newline-delimited log written to
+// it as a message to a Kafka topic, in batches. A log may be split across
+// calls to Write: it is buffered until its newline arrives. It is safe for
+// concurrent use.
+//
+// Messages are produced once a batch is full, so the last logs of a pull are
+// only produced by Flush or Close, which must be called before exiting.
+type Writer struct {
+	mu        sync.Mutex
+	producer  *kafkago.Writer
+	ctx       context.Context
+	batchSize int
+	partial   []byte
+	batch     []kafkago.Message
+}
+
+// Option configures a Writer.
+type Option func(*Writer)
+
+// WithBatchSize sets the number of logs produced in each batch. It defaults
+// to 100.
+func WithBatchSize(n int) Option {
+	return func(w *Writer) {
+		if n > 0 {
+			w.batchSize = n
+		}
+	}
+}
+
+// WithContext sets the context that bounds producing each batch. It defaults
+// to context.Background().
+func WithContext(ctx context.Context) Option {
+	return func(w *Writer) {
+		w.ctx = ctx
+	}
+}
+
+// WithProducer adjusts the underlying kafka-go Writer, e.g. to set its
+// Balancer, Transport (for TLS or SASL) or RequiredAcks.
+func WithProducer(fn func(*kafkago.Writer)) Option {
+	return func(w *Writer) {
+		fn(w.producer)
+	}
+}
+
+// NewWriter returns a Writer producing to topic on the given brokers.
+func NewWriter(brokers []string, topic string, opts ...Option) *Writer {
+	w := &Writer{
+		producer: &kafkago.Writer{
+			Addr:  kafkago.TCP(brokers...),
+			Topic: topic,
+			// Batches are assembled by Writer, so send them without waiting.
+			BatchTimeout: defaultBatchTimeout,
+		},
+		ctx:       context.Background(),
+		batchSize: defaultBatchSize,
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.producer.BatchSize = w.batchSize
+
+	return w
+}
+
+// Write buffers the logs in p, producing a batch each time one fills. It
+// reports any error producing a batch, though p is always consumed.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	data := p
+	if len(w.partial) > 0 {
+		data = append(w.partial, p...)
+	}
+
+	var err error
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+
+		w.add(data[:i])
+		data = data[i+1:]
+
+		if len(w.batch) >= w.batchSize && err == nil {
+			err = w.flush()
+		}
+	}
+
+	// Keep the start of an incomplete log for the next Write.
+	w.partial = append(w.partial[:0:0], data...)
+
+	return len(p), err
+}
+
+// add queues a log as a message, ignoring blank lines.
+func (w *Writer) add(log []byte) {
+	if len(bytes.TrimSpace(log)) == 0 {
+		return
+	}
+
+	w.batch = append(w.batch, kafkago.Message{Value: append([]byte(nil), log...)})
+}
+
+// Flush produces the complete logs buffered so far.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.flush()
+}
+
+func (w *Writer) flush() error {
+	if len(w.batch) == 0 {
+		return nil
+	}
+
+	batch := w.batch
+	w.batch = nil
+	if err := w.producer.WriteMessages(w.ctx, batch...); err != nil {
+		return errors.Wrapf(err, "failed to produce %d logs to %s", len(batch), w.producer.Topic)
+	}
+
+	return nil
+}
+
+// Close produces any buffered logs, including a final log without a trailing
+// newline, and closes the connection to the brokers.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.add(w.partial)
+	w.partial = nil
+
+	err := w.flush()
+	if cerr := w.producer.Close(); err == nil && cerr != nil {
+		err = errors.Wrap(cerr, "failed to close Kafka producer")
+	}
+
+	return err
+}
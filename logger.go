@@ -0,0 +1,13 @@
+package logshare
+
+// Logger receives diagnostics from a Client, such as retries, waits for
+// Options.RateLimit and progress through the windows of a chunked request.
+// *log.Logger implements it.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// nopLogger discards diagnostics, which is the default.
+type nopLogger struct{}
+
+func (nopLogger) Printf(string, ...interface{}) {}
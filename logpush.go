@@ -0,0 +1,159 @@
+package logshare
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LogpushClient manages the Logpush jobs of zones, which push logs to a
+// destination such as cloud storage instead of them being pulled. It is
+// created from a Client with Client.Logpush, and shares its credentials, API
+// endpoint, HTTP client and headers.
+type LogpushClient struct {
+	c *Client
+}
+
+// JobSpec describes a Logpush job to create.
+type JobSpec struct {
+	// An optional name for the job, e.g. the domain it pushes logs for.
+	Name string `json:"name,omitempty"`
+	// Where to push logs to, e.g. "s3://bucket/path?region=us-west-2".
+	DestinationConf string `json:"destination_conf"`
+	// The dataset to push, e.g. "http_requests".
+	Dataset string `json:"dataset,omitempty"`
+	// The fields and timestamp format of pushed logs, in the form of a
+	// Logpull query string, e.g. "fields=RayID,ClientIP&timestamps=rfc3339".
+	LogpullOptions string `json:"logpull_options,omitempty"`
+	Enabled        bool   `json:"enabled"`
+}
+
+// LogpushJob is a Logpush job, as returned by the API.
+type LogpushJob struct {
+	ID              int    `json:"id"`
+	Name            string `json:"name"`
+	Dataset         string `json:"dataset"`
+	DestinationConf string `json:"destination_conf"`
+	LogpullOptions  string `json:"logpull_options"`
+	Enabled         bool   `json:"enabled"`
+	// When logs were last pushed successfully, and when pushing last failed
+	// and why. Nil if never.
+	LastComplete *time.Time `json:"last_complete"`
+	LastError    *time.Time `json:"last_error"`
+	ErrorMessage string     `json:"error_message"`
+}
+
+// Logpush returns a client for managing Logpush jobs with the same
+// configuration as c.
+func (c *Client) Logpush() *LogpushClient {
+	return &LogpushClient{c: c}
+}
+
+// ListJobs returns the zone's Logpush jobs.
+func (lc *LogpushClient) ListJobs(zoneID string) ([]LogpushJob, error) {
+	var jobs []LogpushJob
+	if err := lc.do("GET", lc.jobsURL(zoneID), nil, &jobs); err != nil {
+		return nil, errors.Wrap(err, "failed to list Logpush jobs")
+	}
+
+	return jobs, nil
+}
+
+// CreateJob creates a Logpush job for the zone, returning it as created.
+func (lc *LogpushClient) CreateJob(zoneID string, job JobSpec) (*LogpushJob, error) {
+	if job.DestinationConf == "" {
+		return nil, errors.New("JobSpec.DestinationConf cannot be empty")
+	}
+
+	created := &LogpushJob{}
+	if err := lc.do("POST", lc.jobsURL(zoneID), job, created); err != nil {
+		return nil, errors.Wrap(err, "failed to create Logpush job")
+	}
+
+	return created, nil
+}
+
+// DeleteJob deletes one of the zone's Logpush jobs.
+func (lc *LogpushClient) DeleteJob(zoneID string, jobID int) error {
+	u := lc.jobsURL(zoneID) + "/" + strconv.Itoa(jobID)
+	if err := lc.do("DELETE", u, nil, nil); err != nil {
+		return errors.Wrapf(err, "failed to delete Logpush job %d", jobID)
+	}
+
+	return nil
+}
+
+func (lc *LogpushClient) jobsURL(zoneID string) string {
+	return fmt.Sprintf("%s/zones/%s/logpush/jobs", lc.c.endpoint, zoneID)
+}
+
+// do makes an API request, sending in as JSON if it is not nil, and decodes the
+// result of the response envelope into out if it is not nil.
+func (lc *LogpushClient) do(method string, rawURL string, in interface{}, out interface{}) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode request")
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := lc.c.newRequest(context.Background(), method, u, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if err := lc.c.waitRateLimit(req.Context()); err != nil {
+		return err
+	}
+
+	resp, err := lc.c.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "HTTP request failed")
+	}
+	defer resp.Body.Close()
+
+	decoded, err := decodeBody(resp)
+	if err != nil {
+		return err
+	}
+	defer decoded.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(decoded, 1000000))
+	if err != nil {
+		return errors.Wrapf(err, "HTTP status %d: failed to read response", resp.StatusCode)
+	}
+
+	var envelope struct {
+		Success bool            `json:"success"`
+		Result  json.RawMessage `json:"result"`
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || json.Unmarshal(data, &envelope) != nil || !envelope.Success {
+		return newAPIError(resp.StatusCode, data)
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(envelope.Result, out); err != nil {
+			return errors.Wrap(err, "failed to decode response")
+		}
+	}
+
+	return nil
+}
@@ -2,118 +2,829 @@ package logshare
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/cloudflare/logshare/encrypt"
 	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
 )
 
 const (
 	apiURL     = "https://api.cloudflare.com/client/v4"
-	unix       = "unix"
-	unixNano   = "unixnano"
-	rfc3339    = "rfc3339"
 	byReceived = "received"
 	byRayID    = "rayids"
 )
 
+// Version is the version of logshare sent in the User-Agent of its requests,
+// as "logshare/<Version>". Programs may set it before making requests, for
+// example at build time with
+// -ldflags "-X github.com/cloudflare/logshare.Version=v1.2.3".
+var Version = "dev"
+
+// TimestampFormat selects how the API formats the timestamps in logs.
+type TimestampFormat string
+
+const (
+	// Unix formats timestamps as Unix seconds.
+	Unix TimestampFormat = "unix"
+	// UnixNano formats timestamps as Unix nanoseconds. This is the API's
+	// default.
+	UnixNano TimestampFormat = "unixnano"
+	// RFC3339 formats timestamps as RFC 3339 strings, e.g.
+	// "2018-01-02T15:04:05Z".
+	RFC3339 TimestampFormat = "rfc3339"
+)
+
+// ParseTimestampFormat returns the TimestampFormat named by s, or an error if
+// it is not one of "unix", "unixnano" or "rfc3339".
+func ParseTimestampFormat(s string) (TimestampFormat, error) {
+	switch f := TimestampFormat(s); f {
+	case Unix, UnixNano, RFC3339:
+		return f, nil
+	default:
+		return "", errors.Errorf("unknown timestamp format %q: expected %q, %q or %q", s, Unix, UnixNano, RFC3339)
+	}
+}
+
+// CountOrder selects which logs of a window are kept when a request is limited
+// to a number of logs.
+type CountOrder string
+
+const (
+	// CountFirst keeps the first logs the API returns for the window. This is
+	// the API's own behavior.
+	CountFirst CountOrder = "first"
+	// CountLast keeps the last logs the API returns for the window.
+	CountLast CountOrder = "last"
+)
+
+// ParseCountOrder returns the CountOrder named by s, or an error if it is not
+// one of "first" or "last".
+func ParseCountOrder(s string) (CountOrder, error) {
+	switch o := CountOrder(s); o {
+	case CountFirst, CountLast:
+		return o, nil
+	default:
+		return "", errors.Errorf("unknown count order %q: expected %q or %q", s, CountFirst, CountLast)
+	}
+}
+
+// defaultMaxLogLineBytes is the default Options.MaxLogLineBytes.
+const defaultMaxLogLineBytes = 4 << 20
+
+// defaultHTTPTimeout is the default Options.HTTPTimeout.
+const defaultHTTPTimeout = 30 * time.Second
+
+// ErrNoLogs is returned when the API has no logs to return, such as for a Ray
+// ID that does not exist or has aged out of retention, or when it responds 204
+// No Content. Errors wrapping it can be identified with errors.Is(err,
+// ErrNoLogs) or errors.Cause(err) == ErrNoLogs, e.g. to treat an empty window
+// as non-fatal.
+var ErrNoLogs = errors.New("no logs available")
+
+// ErrNotEntitled is returned when a zone does not have Log Share enabled, as
+// found by probing it after a 204 No Content. It wraps ErrNoLogs, so errors
+// wrapping it also match ErrNoLogs; use errors.Is(err, ErrNotEntitled) to tell
+// a zone without Log Share from an empty window.
+var ErrNotEntitled = wrapf(ErrNoLogs, "Log Share is not enabled for the zone")
+
+// ErrBeyondRetention is returned, without contacting the API, when a request
+// starts further in the past than Options.RetentionWindow allows.
+var ErrBeyondRetention = errors.New("start is beyond the log retention window")
+
 // Client holds the current API credentials & HTTP client configuration. Client
-// should not be modified concurrently.
+// should not be modified concurrently, but its methods may be called from
+// several goroutines at once: the state of each call, such as sequence numbers
+// and warnings, is its own.
 type Client struct {
-	endpoint        string
-	apiKey          string
-	apiEmail        string
-	sample          float64
-	timestampFormat string
-	fields          []string
-	httpClient      *http.Client
-	dest            io.Writer
-	headers         http.Header
+	endpoint         string
+	apiKey           string
+	apiEmail         string
+	apiToken         string
+	sample           float64
+	timestampFormat  TimestampFormat
+	fields           []string
+	fieldsByZone     map[string][]string
+	fieldAliases     map[string]string
+	countOrder       CountOrder
+	columns          []string
+	httpClient       *http.Client
+	dest             io.Writer
+	headers          http.Header
+	canonicalize     bool
+	format           OutputFormat
+	forceRequest     bool
+	strictCT         bool
+	onProgress       func(Progress)
+	progressInterval time.Duration
+	entitlement      *entitlementMemo
+	fieldCache       *fieldCache
+	closers          []io.Closer
+	partitioner      *partitioner
+	flight           *singleflight.Group
+	adaptiveWindow   bool
+	minWindow        time.Duration
+	maxWindow        time.Duration
+	retentionWindow  time.Duration
+	sequenceField    string
+	split            bufio.SplitFunc
+	terminator       []byte
+	throttle         *throttle
+	encrypted        bool
+	compressed       bool
+	outputs          []OutputSpec
+	emptyAsError     bool
+	observeFields    bool
+	extraParams      url.Values
+	allowedParams    map[string]bool
+	overrideParams   map[string]bool
+	laxParams        bool
+	breaker          *breaker
+	retry            *RetryPolicy
+	gzip             bool
+	maxLineBytes     int
+	validateFields   bool
+	metrics          Metrics
+	csvHeaders       *csvHeaders
+	limiter          *rate.Limiter
+	concurrency      int
+	filter           func(log map[string]interface{}) bool
+	allFields        bool
+	windowProgress   func(windowStart int64, windowEnd int64, countSoFar int)
+	logger           Logger
+	checksum         bool
+	userDests        []io.Writer
+	ownHTTPClient    bool
+
+	// The clock used for timing requests. Tests can replace it to get
+	// deterministic durations.
+	now func() time.Time
 }
 
 // Options for configuring log retrieval requests.
 type Options struct {
-	// Provide a custom HTTP client. Defaults to a barebones *http.Client.
+	// Authenticate with a scoped API token, sent as an "Authorization:
+	// Bearer" header, instead of an API key and email. When set, the apiKey
+	// and apiEmail passed to New may be empty.
+	APIToken string
+	// Provide a custom HTTP client, used as-is. Defaults to an *http.Client
+	// with HTTPTimeout set.
 	HTTPClient *http.Client
-	// Provide custom HTTP request headers.
+	// The timeout for each request made by the default HTTP client, including
+	// reading the response. Defaults to 30s. Long pulls, such as fetching all
+	// logs in a large range, may need a larger timeout, or an HTTPClient
+	// without one and a per-request context (e.g. GetFromTimestampContext)
+	// instead. Ignored if HTTPClient is set.
+	HTTPTimeout time.Duration
+	// Provide custom HTTP request headers. A User-Agent given here replaces
+	// the default of "logshare/<Version>".
 	Headers http.Header
-	// Destination to stream logs to.
+	// Destination to stream logs to. The caller is responsible for closing
+	// it.
 	Dest io.Writer
-	// Which timestamp format to use: one of "unix", "unixnano", "rfc3339"
-	TimestampFormat string
-	// Whether to only retrieve a sample of logs (0.001 to 1)
+	// A chain of writers to stream logs through, in construction order: each
+	// writer wraps the one before it, and the last receives logs first (e.g.
+	// an upload, then an encrypting writer, then a gzip writer). The client
+	// owns the chain: once a call that streams logs returns, every writer is
+	// closed, last first, and any close errors are returned from that call.
+	// The client cannot stream logs again afterwards. Cannot be combined with
+	// Dest.
+	DestChain []io.WriteCloser
+	// Encrypt output with AES-256-GCM using this 32-byte key. The encrypted
+	// stream is finalized once a call that streams logs returns, so the client
+	// can only stream logs once. Use DecryptingReader to read it back.
+	EncryptKey []byte
+	// Write each log to several destinations, each in its own format, e.g.
+	// NDJSON to a file for archival and pretty JSON to a terminal. Cannot be
+	// combined with the other destination options, or with EncryptKey or
+	// CompressOutput.
+	MultiDest []OutputSpec
+	// Have Close also close Dest and the MultiDest writers when they are
+	// io.Closers. By default the caller remains responsible for them.
+	CloseDest bool
+	// Compress output with gzip. Like EncryptKey, the compressed stream is
+	// finalized once a call that streams logs returns. Compression happens
+	// before any encryption.
+	CompressOutput bool
+	// Flush compressed output at this interval, so that a consumer reading
+	// it live (e.g. through a pipe) sees logs promptly rather than only once
+	// the stream is closed. Zero flushes only at the end, for the best
+	// compression.
+	GzipFlushInterval time.Duration
+	// Write each log to a writer chosen by the value of PartitionField (e.g.
+	// "ClientCountry"), instead of to Dest. DestByKey is called to open the
+	// writer for each value seen, with an empty key for logs without the
+	// field. At most MaxOpenPartitions writers (default 16) are kept open; the
+	// least recently used is closed when another is needed, and DestByKey is
+	// called again if its key reappears, so writers should append rather
+	// than truncate. All writers are closed once a call that streams logs
+	// returns.
+	DestByKey         func(key string) (io.WriteCloser, error)
+	PartitionField    string
+	MaxOpenPartitions int
+	// Which timestamp format to use: one of Unix, UnixNano or RFC3339.
+	// Defaults to the API's default, UnixNano.
+	TimestampFormat TimestampFormat
+	// Which logs to keep when a request for a window is limited to 'count'
+	// logs: CountFirst (the default) or CountLast, e.g. the most recent 100
+	// rather than the earliest. The API only supports the former, so with
+	// CountLast the whole window is requested without a count, and the last
+	// 'count' logs of the response are buffered in memory and written once it
+	// has been read. This costs the transfer of the whole window.
+	CountOrder CountOrder
+	// Whether to only retrieve a sample of logs, as a fraction greater than 0
+	// and at most 1, e.g. 0.25 or 0.01. It is sent to the API with the
+	// precision given. The sample is chosen randomly by the API for each
+	// request; it cannot be seeded, so repeated requests return different
+	// samples.
 	Sample float64
 	// The fields to return in the log responses
 	Fields []string
+	// Request every field available to the zone, as listed by ListFields,
+	// rather than the API's default subset. If the fields cannot be listed,
+	// the default fields are requested for the rest of the call and
+	// Meta.Warnings says why. Cannot be
+	// combined with Fields or FieldsByZone.
+	AllFields bool
+	// Per-zone field lists, keyed by zone ID. Zones without an entry fall back
+	// to Fields. Useful when pulling from several zones whose plans expose
+	// different fields.
+	FieldsByZone map[string][]string
+	// The base URL of the API. Defaults to Cloudflare's public API. Both
+	// https:// and plain http:// URLs are accepted: the latter is useful when
+	// pointing the client at a local mock server.
+	ApiURL string
+	// Re-serialize each log with its keys sorted alphabetically, producing
+	// byte-stable output for identical logs. This fully decodes and re-encodes
+	// every log, so it is noticeably slower than passing logs through.
+	CanonicalizeKeys bool
+	// Rename the top-level keys of each log before it is written, from the
+	// API's field names to these aliases, e.g. {"EdgeResponseStatus":
+	// "status_code"}. Keys without an alias are left unchanged, and an alias
+	// that collides with another key replaces it. Like CanonicalizeKeys, this
+	// decodes and re-encodes every log (leaving its keys sorted), so it is
+	// noticeably slower than passing logs through; logs pass through untouched
+	// when the map is empty. Filter and PartitionField still see the API's
+	// names, while the columns of FormatCSV and FormatLogfmt use the aliases.
+	FieldAliases map[string]string
+	// The format to write logs to Dest in: one of FormatJSON (the default),
+	// FormatLogfmt, FormatPretty or FormatCSV.
+	Format OutputFormat
+	// Always issue requests, even for zones previously found not to have Log
+	// Share enabled. See Client.ResetEntitlement.
+	ForceRequest bool
+	// Reject successful responses whose Content-Type is not JSON or NDJSON,
+	// such as an HTML error page served with a 200 by a misconfigured proxy.
+	StrictContentType bool
+	// Called periodically while logs are streamed, and once when a response
+	// has been fully streamed.
+	OnProgress func(Progress)
+	// Receives the same progress updates as OnProgress, written as one JSON
+	// object per line, e.g. {"count":1200,"bytes":845000,"elapsed_ms":1500}.
+	// This keeps machine-readable progress separate from the log destination.
+	ProgressWriter io.Writer
+	// How often to report progress. Defaults to one second.
+	ProgressInterval time.Duration
+	// Called after each window of a request split into windows, such as
+	// GetFromTimeRange or GetFromTimestamp with AllLogs, with the window's
+	// bounds (in Unix seconds) and the number of logs fetched so far across
+	// all windows. It is called from the goroutine making the requests, so
+	// it need not be safe for concurrent use.
+	ProgressFunc func(windowStart int64, windowEnd int64, countSoFar int)
+	// Adapt the window size used by GetFromTimeRange to the density of logs,
+	// between MinWindow (default one minute) and MaxWindow (default one hour).
+	AdaptiveWindow bool
+	MinWindow      time.Duration
+	MaxWindow      time.Duration
+	// Share a single upstream request between concurrent calls for the same
+	// URL (zone, window, fields and other parameters) and credentials. The
+	// response is buffered in memory and then written to each caller's
+	// destination, so destinations must be independent: callers sharing one
+	// destination would each write a copy of the logs to it. Cancelling the
+	// context of the call that issued the request aborts it for every caller.
+	CoalesceRequests bool
+	// Reject requests starting longer ago than this, which would otherwise
+	// return confusingly empty results. Cloudflare typically retains logs for
+	// 7 days when log retention is enabled for a zone. Zero (the default)
+	// disables the check.
+	RetentionWindow time.Duration
+	// Add an incrementing sequence number under this key to each log written,
+	// starting from 1. Numbering continues across the windows of a chunked
+	// request (see GetFromTimeRange) and restarts once the call returns.
+	SequenceField string
+	// The function used to split response bodies into logs. Defaults to
+	// bufio.ScanLines for newline-delimited JSON; see ScanRecords for JSON
+	// text sequences.
+	SplitFunc bufio.SplitFunc
+	// The bytes written after each log, and after the header row of
+	// FormatCSV. Defaults to "\n" when nil; set it to []byte("\r\n") for CRLF
+	// line endings, or to an empty, non-nil slice to write logs back to back
+	// for consumers that frame them by other means.
+	LineTerminator []byte
+	// Limit writes to the destination to this many bytes per second. Zero
+	// means unlimited.
+	ThrottleWrites int64
+	// Limit requests to the API to this many per second, across every
+	// goroutine using the client and its clones, to stay within the
+	// account's rate limits. Requests block until they are allowed. Zero
+	// means unlimited.
+	RateLimit float64
+	// Only write logs for which Filter returns true, e.g. to keep only
+	// responses with errors:
+	//
+	//	Filter: func(log map[string]interface{}) bool {
+	//		status, _ := log["EdgeResponseStatus"].(float64)
+	//		return status >= 500
+	//	}
+	//
+	// Each log is decoded with encoding/json before being passed to Filter,
+	// so numbers are float64s, and filtering is noticeably slower than
+	// passing logs through. Meta.Count is the number of logs that passed
+	// the filter, and Meta.ScannedCount the number read.
+	Filter func(log map[string]interface{}) bool
+	// The most zones GetFromTimestampMulti fetches at once. Defaults to 4.
+	Concurrency int
+	// Return ErrNoLogs from GetFromTimestamp when the API responds 200 OK
+	// with no logs. The API responds 204 No Content when it has no logs to
+	// serve at all, typically because Log Share is not enabled for the zone
+	// or the logs are not available yet, whereas an empty 200 means the
+	// request succeeded but nothing was logged in the window. By default an
+	// empty 200 returns a Meta with a zero Count and no error.
+	TreatEmptyAsError bool
+	// Record the keys that appear in the logs written, in
+	// Meta.ObservedFields.
+	ObserveFields bool
+	// Compute a SHA-256 of the logs written, in Meta.Checksum. It is off by
+	// default to avoid the cost of hashing.
+	Checksum bool
+	// Additional query parameters to send with each log request, such as
+	// API features this package does not support yet. Parameters the
+	// package sets itself take precedence, unless listed in OverrideParams.
+	// Parameters other than the
+	// documented Logpull ones must be listed in AllowedExtraParams, so that
+	// a typo such as "smaple" is an error rather than silently ignored.
+	ExtraParams url.Values
+	// Extra query parameters to accept in ExtraParams.
+	AllowedExtraParams []string
+	// Accept any parameter in ExtraParams.
+	LaxParams bool
+	// Parameters in ExtraParams that replace the values the package sets
+	// itself, such as "fields". Each must be present in ExtraParams.
+	OverrideParams []string
+	// Open a circuit breaker after this many consecutive failed requests
+	// (transport errors, 429s and 5xx responses), failing further requests
+	// with ErrCircuitOpen until BreakerCooldown has passed. A single probe
+	// request is then let through, closing the breaker if it succeeds. Zero
+	// disables the breaker.
+	BreakerThreshold int
+	// How long the breaker stays open. Defaults to 30 seconds.
+	BreakerCooldown time.Duration
+	// Retry requests that fail with a transient status. No retries are made
+	// by default.
+	RetryPolicy *RetryPolicy
+	// Ask the API to gzip responses, or to compress them with Brotli when
+	// built with the brotli tag. Responses with a supported Content-Encoding
+	// are decompressed whether or not this is set.
+	Gzip bool
+	// The longest log line that can be read, in bytes. Longer lines fail
+	// the request with bufio.ErrTooLong. Defaults to 4MB.
+	MaxLogLineBytes int
+	// Check the requested fields with ValidateFields before fetching logs by
+	// timestamp, so that a misspelt field fails fast. The field listing is
+	// cached, so this costs one extra request per zone.
+	ValidateFields bool
+	// Record the duration, log count and outcome of each request, e.g. with
+	// the github.com/cloudflare/logshare/prometheus package.
+	Metrics Metrics
+	// Receive diagnostics, such as retries, rate limit waits and windowing
+	// progress. Nothing is logged by default.
+	Logger Logger
 }
 
 // Meta contains data about the API response: the number of logs returned,
 // the duration of the request, the HTTP status code and the constructed URL.
+// Truncated is set when the number of logs returned reached the requested
+// count, so the window may hold more logs than were returned, or when reading
+// the response failed part way, e.g. because the connection dropped. A log cut
+// short by a failed read is never written.
+//
+// For requests split into windows (see GetFromTimeRange), Meta holds the
+// aggregate and Chunks describes each window.
 type Meta struct {
-	Count      int
-	Duration   int64
-	StatusCode int
-	URL        string
+	Count      int         `json:"count"`
+	Duration   int64       `json:"duration_ms"`
+	StatusCode int         `json:"status_code"`
+	URL        string      `json:"url"`
+	Truncated  bool        `json:"truncated"`
+	Chunks     []ChunkInfo `json:"chunks,omitempty"`
+	// The cumulative time spent writing logs to the destination, including
+	// any time spent waiting on ThrottleWrites, in milliseconds.
+	WriteWaitTime int64 `json:"write_wait_ms"`
+	// The sorted union of the top-level keys of the logs written, when
+	// Options.ObserveFields is set. Comparing it with the requested fields
+	// shows any that were not delivered.
+	ObservedFields []string `json:"observed_fields,omitempty"`
+	// The number of attempts made at the request, including retries. For
+	// chunked requests, the total across all windows.
+	Attempts int `json:"attempts"`
+	// The Ray ID of the last log streamed successfully, for resuming an
+	// interrupted pull with GetFromRayIDRange. Empty if RayID is not among
+	// the requested fields.
+	LastRayID string `json:"last_ray_id,omitempty"`
+	// The number of bytes of logs read from the response, counting a newline
+	// after each log. Blank lines are not counted.
+	BytesRead int64 `json:"bytes_read"`
+	// The number of logs read from the response, including any dropped by
+	// Options.Filter. Without a filter, it equals Count.
+	ScannedCount int `json:"scanned_count"`
+	// Problems that did not fail the call, such as falling back to the
+	// default fields because Options.AllFields could not list them.
+	Warnings []string `json:"warnings,omitempty"`
+	// The Content-Encoding of the response, such as "gzip" when
+	// Options.Gzip is set and the API compressed it. Empty for an
+	// uncompressed response. For chunked requests, that of the last window.
+	ContentEncoding string `json:"content_encoding,omitempty"`
+	// The API's rate limit as reported with the response, or zero if the
+	// response did not report it. For chunked requests, that of the last
+	// window.
+	RateLimit RateLimit `json:"rate_limit"`
+	// With Options.Checksum, the hex-encoded SHA-256 of the logs handed to the
+	// destination, as received and each followed by a newline, before any
+	// Filter or formatting. For a plain pull these are the bytes counted by
+	// BytesRead. It covers every window of a chunked request (see
+	// GetFromTimeRange), and restarts with each call.
+	Checksum string `json:"checksum,omitempty"`
+
+	// How long the API asked us to wait before retrying, from Retry-After.
+	retryAfter time.Duration
+}
+
+// ChunkInfo describes a single window of a chunked request.
+type ChunkInfo struct {
+	// The window, in Unix seconds.
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	// The number of logs returned for the window.
+	Count int `json:"count"`
+	// The duration of the request, in milliseconds.
+	Duration   int64 `json:"duration_ms"`
+	StatusCode int   `json:"status_code"`
+	Truncated  bool  `json:"truncated"`
 }
 
 // New creates a new client instance for consuming logs from
 // Cloudflare's Enterprise Log Share API. A client should not be modified during
-// HTTP requests.
+// HTTP requests. Either apiKey and apiEmail, or Options.APIToken, must be
+// provided.
 func New(apiKey string, apiEmail string, options *Options) (*Client, error) {
-	if apiKey == "" {
-		return nil, errors.New("apiKey cannot be empty")
+	var apiToken string
+	if options != nil {
+		apiToken = options.APIToken
 	}
 
-	if apiEmail == "" {
-		return nil, errors.New("apiEmail cannot be empty")
+	if apiToken == "" {
+		if apiKey == "" {
+			return nil, errors.New("apiKey cannot be empty")
+		}
+
+		if apiEmail == "" {
+			return nil, errors.New("apiEmail cannot be empty")
+		}
 	}
 
 	client := &Client{
-		apiKey:     apiKey,
-		apiEmail:   apiEmail,
-		endpoint:   apiURL,
-		httpClient: http.DefaultClient,
-		dest:       os.Stdout,
-		headers:    make(http.Header),
+		apiKey:           apiKey,
+		apiEmail:         apiEmail,
+		apiToken:         apiToken,
+		endpoint:         apiURL,
+		httpClient:       &http.Client{Timeout: defaultHTTPTimeout},
+		dest:             os.Stdout,
+		headers:          make(http.Header),
+		format:           FormatJSON,
+		progressInterval: defaultProgressInterval,
+		entitlement:      newEntitlementMemo(),
+		fieldCache:       newFieldCache(),
+		minWindow:        defaultMinWindow,
+		maxWindow:        defaultMaxWindow,
+		split:            bufio.ScanLines,
+		terminator:       newline,
+		logger:           nopLogger{},
+		maxLineBytes:     defaultMaxLogLineBytes,
+		csvHeaders:       newCSVHeaders(),
+		ownHTTPClient:    true,
+		concurrency:      defaultConcurrency,
+		now:              time.Now,
 	}
 
 	if options != nil {
+		if options.ApiURL != "" {
+			u, err := url.Parse(options.ApiURL)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid ApiURL")
+			}
+
+			if u.Scheme != "http" && u.Scheme != "https" {
+				return nil, errors.Errorf("ApiURL must be an http:// or https:// URL, got %q", options.ApiURL)
+			}
+
+			client.endpoint = strings.TrimSuffix(options.ApiURL, "/")
+		}
+
+		if options.HTTPTimeout < 0 {
+			return nil, errors.New("HTTPTimeout cannot be negative")
+		}
+		switch {
+		case options.HTTPClient != nil:
+			client.httpClient = options.HTTPClient
+			client.ownHTTPClient = false
+		case options.HTTPTimeout > 0:
+			client.httpClient = &http.Client{Timeout: options.HTTPTimeout}
+		}
+
+		if options.TimestampFormat != "" {
+			if _, err := ParseTimestampFormat(string(options.TimestampFormat)); err != nil {
+				return nil, err
+			}
+		}
 		client.timestampFormat = options.TimestampFormat
+		if options.CountOrder != "" {
+			if _, err := ParseCountOrder(string(options.CountOrder)); err != nil {
+				return nil, err
+			}
+		}
+		client.countOrder = options.CountOrder
+		if options.Sample < 0 || options.Sample > 1 {
+			return nil, errors.Errorf("Sample must be greater than 0 and at most 1, got %v", options.Sample)
+		}
 		client.sample = options.Sample
+		client.canonicalize = options.CanonicalizeKeys
+		client.forceRequest = options.ForceRequest
+
+		client.retentionWindow = options.RetentionWindow
+		client.sequenceField = options.SequenceField
+		client.emptyAsError = options.TreatEmptyAsError
+		client.observeFields = options.ObserveFields
+		client.checksum = options.Checksum
+
+		if options.BreakerThreshold < 0 || options.BreakerCooldown < 0 {
+			return nil, errors.New("BreakerThreshold and BreakerCooldown cannot be negative")
+		}
+		if options.BreakerThreshold > 0 {
+			cooldown := options.BreakerCooldown
+			if cooldown == 0 {
+				cooldown = defaultBreakerCooldown
+			}
+			client.breaker = newBreaker(options.BreakerThreshold, cooldown, client.now)
+		}
+
+		client.gzip = options.Gzip
+		client.validateFields = options.ValidateFields
+		client.metrics = options.Metrics
+		if options.Logger != nil {
+			client.logger = options.Logger
+		}
+		client.filter = options.Filter
+		client.windowProgress = options.ProgressFunc
+
+		if options.MaxLogLineBytes < 0 {
+			return nil, errors.New("MaxLogLineBytes cannot be negative")
+		}
+		if options.MaxLogLineBytes > 0 {
+			client.maxLineBytes = options.MaxLogLineBytes
+		}
+
+		if options.RetryPolicy != nil {
+			policy := *options.RetryPolicy
+			client.retry = &policy
+		}
+
+		client.extraParams = options.ExtraParams
+		client.laxParams = options.LaxParams
+		if len(options.OverrideParams) > 0 {
+			client.overrideParams = make(map[string]bool, len(options.OverrideParams))
+			for _, key := range options.OverrideParams {
+				if _, ok := options.ExtraParams[key]; !ok {
+					return nil, errors.Errorf("OverrideParams lists %q, which is not in ExtraParams", key)
+				}
+				client.overrideParams[key] = true
+			}
+		}
+		if len(options.AllowedExtraParams) > 0 {
+			client.allowedParams = make(map[string]bool, len(options.AllowedExtraParams))
+			for _, key := range options.AllowedExtraParams {
+				client.allowedParams[key] = true
+			}
+		}
+		if options.SplitFunc != nil {
+			client.split = options.SplitFunc
+		}
+		if options.LineTerminator != nil {
+			client.terminator = append([]byte(nil), options.LineTerminator...)
+		}
+
+		if options.Concurrency < 0 {
+			return nil, errors.New("Concurrency cannot be negative")
+		}
+		if options.Concurrency > 0 {
+			client.concurrency = options.Concurrency
+		}
+
+		if options.RateLimit < 0 {
+			return nil, errors.New("RateLimit cannot be negative")
+		}
+		if options.RateLimit > 0 {
+			// A burst of one paces requests evenly, shared by the client
+			// and its clones.
+			client.limiter = rate.NewLimiter(rate.Limit(options.RateLimit), 1)
+		}
+
+		if options.ThrottleWrites < 0 {
+			return nil, errors.New("ThrottleWrites cannot be negative")
+		}
+		if options.ThrottleWrites > 0 {
+			client.throttle = newThrottle(options.ThrottleWrites)
+		}
+
+		if options.CoalesceRequests {
+			client.flight = &singleflight.Group{}
+		}
+		client.strictCT = options.StrictContentType
+
+		if options.ProgressWriter != nil {
+			client.onProgress = chainProgress(options.OnProgress, progressWriterFunc(options.ProgressWriter))
+		} else {
+			client.onProgress = options.OnProgress
+		}
+
+		if options.ProgressInterval > 0 {
+			client.progressInterval = options.ProgressInterval
+		}
+
+		client.adaptiveWindow = options.AdaptiveWindow
+		if options.MinWindow > 0 {
+			client.minWindow = options.MinWindow
+		}
+
+		if options.MaxWindow > 0 {
+			client.maxWindow = options.MaxWindow
+		}
+
+		if client.minWindow > client.maxWindow {
+			return nil, errors.New("MinWindow cannot be larger than MaxWindow")
+		}
+
+		if options.Format != "" {
+			if err := checkFormat(options.Format, options.Fields); err != nil {
+				return nil, err
+			}
+			client.format = options.Format
+		}
+
+		if len(options.MultiDest) > 0 {
+			if options.Dest != nil || len(options.DestChain) > 0 || options.DestByKey != nil {
+				return nil, errors.New("MultiDest cannot be combined with Dest, DestChain or DestByKey")
+			}
+
+			if options.EncryptKey != nil || options.CompressOutput {
+				return nil, errors.New("MultiDest cannot be combined with EncryptKey or CompressOutput")
+			}
+
+			for i, out := range options.MultiDest {
+				if out.Writer == nil {
+					return nil, errors.Errorf("MultiDest[%d] has no Writer", i)
+				}
+
+				if out.Format == "" {
+					out.Format = client.format
+				} else if err := checkFormat(out.Format, options.Fields); err != nil {
+					return nil, errors.Wrapf(err, "MultiDest[%d]", i)
+				}
+				client.outputs = append(client.outputs, out)
+			}
+		}
 
 		if options.Dest != nil {
 			client.dest = options.Dest
 		}
 
+		if options.CloseDest {
+			if options.Dest != nil {
+				client.userDests = append(client.userDests, options.Dest)
+			}
+			for _, out := range options.MultiDest {
+				client.userDests = append(client.userDests, out.Writer)
+			}
+		}
+
+		if len(options.DestChain) > 0 {
+			if options.Dest != nil {
+				return nil, errors.New("only one of Dest and DestChain may be set")
+			}
+
+			for _, w := range options.DestChain {
+				client.closers = append(client.closers, w)
+			}
+			client.dest = options.DestChain[len(options.DestChain)-1]
+		}
+
+		if (options.DestByKey == nil) != (options.PartitionField == "") {
+			return nil, errors.New("DestByKey and PartitionField must be set together")
+		}
+
+		if options.DestByKey != nil {
+			max := options.MaxOpenPartitions
+			if max <= 0 {
+				max = defaultMaxOpenPartitions
+			}
+			client.partitioner = newPartitioner(options.PartitionField, options.DestByKey, max)
+		}
+
+		if options.EncryptKey != nil {
+			ew, err := encrypt.NewWriter(client.dest, options.EncryptKey)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid EncryptKey")
+			}
+			client.dest = ew
+			client.closers = append(client.closers, ew)
+			client.encrypted = true
+		}
+
+		if options.GzipFlushInterval < 0 {
+			return nil, errors.New("GzipFlushInterval cannot be negative")
+		}
+
+		if options.CompressOutput {
+			gw := newGzipWriter(client.dest, options.GzipFlushInterval)
+			client.dest = gw
+			client.closers = append(client.closers, gw)
+			client.compressed = true
+		}
+
 		if options.Fields != nil {
 			client.fields = options.Fields
 		}
+
+		if options.FieldsByZone != nil {
+			client.fieldsByZone = options.FieldsByZone
+		}
+
+		if options.AllFields && (options.Fields != nil || options.FieldsByZone != nil) {
+			return nil, errors.New("AllFields cannot be combined with Fields or FieldsByZone")
+		}
+		client.allFields = options.AllFields
+
+		if options.Headers != nil {
+			client.headers = cloneHeader(options.Headers)
+		}
+
+		if len(options.FieldAliases) > 0 {
+			client.fieldAliases = options.FieldAliases
+		}
 	}
+	client.columns = aliasFields(client.fields, client.fieldAliases)
 
 	return client, nil
 }
 
-func (c *Client) buildURL(zoneID string, params url.Values) (*url.URL, error) {
+func (c *call) buildURL(zoneID string, params url.Values) (*url.URL, error) {
+	return c.buildScopeURL(zoneScope(zoneID), params)
+}
+
+// buildScopeURL returns the URL requesting the scope's logs with the given
+// parameters, to which it adds those set by the client's options.
+func (c *call) buildScopeURL(scope logScope, params url.Values) (*url.URL, error) {
 	endpointType := byReceived
 
 	rayID := params.Get("rayid")
 	if rayID != "" {
+		if scope.isAccount() {
+			return nil, errors.New("logs can only be fetched by Ray ID for a zone")
+		}
 		endpointType = byRayID
 		params.Del("rayid")
 	}
 
 	u, err := url.Parse(
-		fmt.Sprintf("%s/zones/%s/logs/%s",
+		fmt.Sprintf("%s/%s/%s",
 			c.endpoint,
-			zoneID,
+			scope.path(),
 			endpointType,
 		),
 	)
@@ -125,16 +836,26 @@ func (c *Client) buildURL(zoneID string, params url.Values) (*url.URL, error) {
 		u.Path = path.Join(u.Path, rayID)
 	}
 
-	if len(c.fields) >= 1 {
-		params.Set("fields", strings.Join(c.fields, ","))
+	if fields := c.scopeFields(scope); len(fields) >= 1 {
+		params.Set("fields", strings.Join(fields, ","))
 	}
 
 	if endpointType != byRayID && c.sample != 0.0 {
-		params.Set("sample", strconv.FormatFloat(c.sample, 'f', 3, 64))
+		params.Set("sample", strconv.FormatFloat(c.sample, 'f', -1, 64))
 	}
 
 	if c.timestampFormat != "" {
-		params.Set("timestamps", c.timestampFormat)
+		params.Set("timestamps", string(c.timestampFormat))
+	}
+
+	if err := c.checkExtraParams(); err != nil {
+		return nil, err
+	}
+
+	for key, values := range c.extraParams {
+		if _, ok := params[key]; !ok || c.overrideParams[key] {
+			params[key] = append([]string(nil), values...)
+		}
 	}
 
 	u.RawQuery = params.Encode()
@@ -142,22 +863,397 @@ func (c *Client) buildURL(zoneID string, params url.Values) (*url.URL, error) {
 	return u, nil
 }
 
-// GetFromRayID fetches a log entry based on a provided Ray ID value.
+// requestFields returns the fields to request for the given zone: every field
+// available to it with AllFields, otherwise those of fieldsFor. A listing that
+// fails is not retried for the rest of the call, such as for later windows of
+// a chunked request, and is reported in the Meta.Warnings of that call only.
+func (c *call) requestFields(zoneID string) []string {
+	if !c.allFields {
+		return c.fieldsFor(zoneID)
+	}
+
+	c.mu.Lock()
+	unlisted := c.unlisted[zoneID]
+	c.mu.Unlock()
+	if unlisted {
+		return c.fieldsFor(zoneID)
+	}
+
+	available, err := c.ListFields(zoneID)
+	if err != nil {
+		c.mu.Lock()
+		if c.unlisted == nil {
+			c.unlisted = make(map[string]bool)
+		}
+		c.unlisted[zoneID] = true
+		c.mu.Unlock()
+		c.warn("requesting the default fields, as the fields of zone %s could not be listed: %v", zoneID, err)
+		return nil
+	}
+
+	fields := make([]string, 0, len(available))
+	for field := range available {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	return fields
+}
+
+// fieldsFor returns the fields to request for the given zone: the zone's entry
+// in FieldsByZone if present, otherwise the global Fields.
+func (c *Client) fieldsFor(zoneID string) []string {
+	if fields, ok := c.fieldsByZone[zoneID]; ok {
+		return fields
+	}
+
+	return c.fields
+}
+
+// GetFromRayID fetches a log entry based on a provided Ray ID value, from the
+// zone's /logs/rayids/<rayID> endpoint. Fields and the timestamp format apply
+// as for other requests; sampling does not.
 func (c *Client) GetFromRayID(zoneID string, rayID string) (*Meta, error) {
+	return c.GetFromRayIDContext(context.Background(), zoneID, rayID, 0)
+}
+
+// GetFromRayIDContext fetches logs for the provided Ray ID value (up to 'count'
+// logs), aborting the request if ctx is cancelled. If the Ray ID is not found,
+// the returned error wraps ErrNoLogs, distinguishing it from authentication or
+// transport failures. A log skipped by Filter still counts as found.
+func (c *Client) GetFromRayIDContext(ctx context.Context, zoneID string, rayID string, count int) (*Meta, error) {
+	cl := c.startCall()
+	if strings.TrimSpace(rayID) == "" {
+		return nil, errors.New("rayID cannot be empty")
+	}
+
+	return cl.finish(cl.getFromRayID(ctx, zoneID, rayID, count))
+}
+
+func (c *call) getFromRayID(ctx context.Context, zoneID string, rayID string, count int) (*Meta, error) {
 	params := url.Values{}
 	params.Set("rayid", rayID)
 
+	if count > 0 {
+		params.Set("count", strconv.Itoa(count))
+	}
+
 	url, err := c.buildURL(zoneID, params)
 	if err != nil {
 		return nil, err
 	}
 
-	return c.request(url)
+	meta, err := c.zoneRequest(ctx, zoneID, url, c.writeLog)
+	if meta != nil && !isNotEntitled(err) && (meta.StatusCode == http.StatusNoContent || meta.StatusCode == http.StatusNotFound || (err == nil && meta.ScannedCount == 0)) {
+		err = wrapf(ErrNoLogs, "ray ID %s not found", rayID)
+	}
+
+	return meta, err
+}
+
+// GetFromRayIDs fetches the logs of each of the given Ray IDs in turn, with a
+// request per Ray ID, writing them all to the destination. Empty and repeated
+// Ray IDs are skipped. Ray IDs that are not found are listed in
+// Meta.Warnings rather than failing the call, unless none of them is found,
+// in which case the returned error wraps ErrNoLogs. Other errors stop the
+// call, and are returned with a Meta describing the logs fetched so far.
+//
+// The returned Meta aggregates the requests as GetFromTimeRange does, with
+// StatusCode and URL those of the last request.
+func (c *Client) GetFromRayIDs(zoneID string, rayIDs []string) (*Meta, error) {
+	cl := c.startCall()
+	seen := make(map[string]bool, len(rayIDs))
+	var ids []string
+	for _, rayID := range rayIDs {
+		rayID = strings.TrimSpace(rayID)
+		if rayID == "" || seen[rayID] {
+			continue
+		}
+		seen[rayID] = true
+		ids = append(ids, rayID)
+	}
+
+	if len(ids) == 0 {
+		return nil, errors.New("rayIDs cannot be empty")
+	}
+
+	total := &Meta{}
+	began := c.makeTimestamp()
+	var missing []string
+	for _, rayID := range ids {
+		meta, err := cl.getFromRayID(context.Background(), zoneID, rayID, 0)
+		if meta != nil {
+			mergeMeta(total, meta)
+		}
+
+		if errors.Cause(err) == ErrNoLogs {
+			missing = append(missing, rayID)
+			continue
+		}
+		if err != nil {
+			total.Duration = c.makeTimestamp() - began
+			return cl.finish(total, wrapf(err, "failed to fetch ray ID %s", rayID))
+		}
+	}
+	total.Duration = c.makeTimestamp() - began
+
+	if len(missing) == len(ids) {
+		return cl.finish(total, wrapf(ErrNoLogs, "none of the %d ray IDs were found", len(ids)))
+	}
+	if len(missing) > 0 {
+		cl.warn("%d of %d ray IDs not found: %s", len(missing), len(ids), strings.Join(missing, ", "))
+	}
+
+	return cl.finish(total, nil)
+}
+
+// GetFromRayIDRange fetches logs following startRayID up to endRayID (up to
+// 'count' logs), such as to resume a pull from the Meta.LastRayID of an
+// interrupted one. endRayID may be empty to fetch up to the latest logs
+// available.
+func (c *Client) GetFromRayIDRange(zoneID string, startRayID string, endRayID string, count int) (*Meta, error) {
+	cl := c.startCall()
+	if strings.TrimSpace(startRayID) == "" {
+		return nil, errors.New("startRayID cannot be empty")
+	}
+
+	params := url.Values{}
+	params.Set("start_id", startRayID)
+	if endRayID != "" {
+		params.Set("end_id", endRayID)
+	}
+	if count > 0 {
+		params.Set("count", strconv.Itoa(count))
+	}
+
+	u, err := cl.buildURL(zoneID, params)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := cl.zoneRequest(context.Background(), zoneID, u, cl.writeLog)
+	// The API's limit applies before any filter, so compare what it sent.
+	if meta != nil && count > 0 && meta.ScannedCount >= count {
+		meta.Truncated = true
+	}
+
+	return cl.finish(meta, err)
 }
 
 // GetFromTimestamp fetches logs between the start and end timestamps provided,
-// (up to 'count' logs).
+// (up to 'count' logs). Timestamps the API would reject are refused without
+// contacting it: start must be before end (if end is non-zero) and not in the
+// future, and end must be at least a minute in the past, as logs take that long
+// to become available.
+//
+// Passing AllLogs as the count fetches every log in the range, by requesting
+// it one minute at a time (as GetFromTimeRange does), rather than as much as
+// the API returns for a single request. With AllLogs, an end of 0 fetches up
+// to a minute before now.
 func (c *Client) GetFromTimestamp(zoneID string, start int64, end int64, count int) (*Meta, error) {
+	return c.GetFromTimestampContext(context.Background(), zoneID, start, end, count)
+}
+
+// GetFromTimestampContext is GetFromTimestamp, aborting the request if ctx is
+// cancelled. Cancelling ctx while logs are streamed stops the stream promptly:
+// the returned Meta counts the logs written so far, and the error wraps
+// ctx.Err(). With AllLogs, ctx bounds every window's request, and no further
+// windows are requested once it is cancelled.
+func (c *Client) GetFromTimestampContext(ctx context.Context, zoneID string, start int64, end int64, count int) (*Meta, error) {
+	cl := c.startCall()
+	return cl.finish(cl.getFromTimestampCount(ctx, zoneID, start, end, count))
+}
+
+// getFromTimestampCount is getFromTimestamp, fetching all logs in windows of
+// allLogsWindow when count is AllLogs.
+func (c *call) getFromTimestampCount(ctx context.Context, zoneID string, start int64, end int64, count int) (*Meta, error) {
+	if count == AllLogs {
+		return c.getFromTimeRange(ctx, zoneID, start, end, allLogsWindow, 0)
+	}
+
+	return c.getFromTimestamp(ctx, zoneID, start, end, count)
+}
+
+// getFromTimestamp is GetFromTimestamp without closing an owned destination
+// chain, so that it can be called once per window of a chunked request.
+func (c *call) getFromTimestamp(ctx context.Context, zoneID string, start int64, end int64, count int) (*Meta, error) {
+	return c.getFromTimestampFunc(ctx, zoneID, start, end, count, c.writeLog)
+}
+
+// GetFromTimestampFunc fetches logs as GetFromTimestamp does, but instead of
+// writing them to the destination calls fn with each log as it is read. fn
+// must not retain the slice it is passed, which is only valid until it
+// returns. If fn returns an error, the stream is aborted and the error is
+// returned along with a Meta describing the logs read so far.
+func (c *Client) GetFromTimestampFunc(zoneID string, start int64, end int64, count int, fn func(log []byte) error) (*Meta, error) {
+	cl := c.startCall()
+	return cl.finishRead(cl.getFromTimestampFunc(context.Background(), zoneID, start, end, count, fn))
+}
+
+// BuildRequestURL returns the URL GetFromTimestamp would request for the given
+// arguments, without making the request, e.g. to check the fields, sample and
+// timestamp parameters before a pull. It returns the same errors as
+// GetFromTimestamp for invalid timestamps. Since AllLogs is fetched with a
+// request per window, count cannot be AllLogs.
+func (c *Client) BuildRequestURL(zoneID string, start int64, end int64, count int) (string, error) {
+	if count == AllLogs {
+		return "", errors.New("cannot build a single request URL for AllLogs")
+	}
+
+	if err := c.checkTimestamps(start, end); err != nil {
+		return "", err
+	}
+
+	u, err := c.startCall().buildURL(zoneID, timestampParams(start, end, count))
+	if err != nil {
+		return "", err
+	}
+
+	return u.String(), nil
+}
+
+func (c *call) getFromTimestampFunc(ctx context.Context, zoneID string, start int64, end int64, count int, fn func(log []byte) error) (*Meta, error) {
+	return c.getFromScope(ctx, zoneScope(zoneID), start, end, count, fn)
+}
+
+// getFromScope fetches up to 'count' logs of the scope between start and end,
+// calling fn with each.
+func (c *call) getFromScope(ctx context.Context, scope logScope, start int64, end int64, count int, fn func(log []byte) error) (*Meta, error) {
+	if err := c.checkTimestamps(start, end); err != nil {
+		return nil, err
+	}
+
+	if !scope.isAccount() && c.validateFields {
+		if err := c.ValidateFields(scope.zoneID); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.retentionWindow > 0 {
+		if oldest := c.now().Add(-c.retentionWindow).Unix(); start < oldest {
+			return nil, errors.Wrapf(ErrBeyondRetention, "start %d is before %d", start, oldest)
+		}
+	}
+
+	if c.countOrder == CountLast && count > 0 {
+		return c.getLastFromScope(ctx, scope, start, end, count, fn)
+	}
+
+	u, err := c.buildScopeURL(scope, timestampParams(start, end, count))
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := c.scopeRequest(ctx, scope, u, fn)
+	// The API's limit applies before any filter, so compare what it sent.
+	if meta != nil && count > 0 && meta.ScannedCount >= count {
+		meta.Truncated = true
+	}
+
+	if err == nil && c.emptyAsError && meta.ScannedCount == 0 {
+		err = wrapf(ErrNoLogs, "HTTP status %d: no logs between %d and %d", meta.StatusCode, start, end)
+	}
+
+	if meta != nil && meta.StatusCode == http.StatusNoContent && !isNotEntitled(err) {
+		err = wrapf(ErrNoLogs, "HTTP status %d: no logs between %d and %d (%s)", meta.StatusCode, start, end, c.noLogsHint(end))
+	}
+
+	return meta, err
+}
+
+// getLastFromScope requests every log of the scope between start and end, and
+// passes only the last 'count' of them to fn once the response has been read.
+func (c *call) getLastFromScope(ctx context.Context, scope logScope, start int64, end int64, count int, fn func(log []byte) error) (*Meta, error) {
+	u, err := c.buildScopeURL(scope, timestampParams(start, end, 0))
+	if err != nil {
+		return nil, err
+	}
+
+	last := newLastLogs(count)
+	meta, err := c.scopeRequest(ctx, scope, u, last.add)
+	if meta != nil {
+		meta.Truncated = meta.Truncated || meta.ScannedCount > count
+	}
+	if meta != nil && meta.StatusCode == http.StatusNoContent && !isNotEntitled(err) {
+		err = wrapf(ErrNoLogs, "HTTP status %d: no logs between %d and %d (%s)", meta.StatusCode, start, end, c.noLogsHint(end))
+	}
+	if err != nil {
+		return meta, err
+	}
+
+	// Count what was written, as the request counted every log it read.
+	meta.Count = 0
+	for _, log := range last.logs() {
+		if err := fn(log); err != nil {
+			if err == errSkipLog {
+				continue
+			}
+			return meta, wrapf(err, "failed to write log")
+		}
+		meta.Count++
+	}
+
+	if c.emptyAsError && meta.ScannedCount == 0 {
+		err = wrapf(ErrNoLogs, "HTTP status %d: no logs between %d and %d", meta.StatusCode, start, end)
+	}
+
+	return meta, err
+}
+
+const (
+	// AllLogs can be passed as the count to GetFromTimestamp to fetch all
+	// logs in the range.
+	AllLogs = -1
+
+	// allLogsWindow is the window size used to fetch AllLogs.
+	allLogsWindow = time.Minute
+)
+
+// minEndAge is how far in the past the end of a request must be, since logs
+// only become available to the API after a delay.
+const minEndAge = time.Minute
+
+// recentEndAge is how recent the end of a window returning 204 No Content
+// must be for the likely cause to be logs not being available yet.
+const recentEndAge = 5 * time.Minute
+
+// noLogsHint suggests why a window ending at end (in Unix seconds, or zero for
+// the API's default) returned 204 No Content.
+func (c *Client) noLogsHint(end int64) string {
+	if end == 0 {
+		return "the window ends at the latest time allowed, and logs can take a few minutes to become available: try an earlier end"
+	}
+
+	if age := c.now().Sub(time.Unix(end, 0)).Truncate(time.Second); age < recentEndAge {
+		return fmt.Sprintf("the window ended only %s ago, and logs can take a few minutes to become available: try an earlier end", age)
+	}
+
+	return "check that Log Share is enabled for the zone"
+}
+
+// checkTimestamps returns an error if the API would reject a request from start
+// to end (in Unix seconds).
+func (c *Client) checkTimestamps(start int64, end int64) error {
+	now := c.now()
+
+	if end > 0 && start >= end {
+		return errors.Errorf("start %d must be before end %d", start, end)
+	}
+
+	if start > now.Unix() {
+		return errors.Errorf("start %d is in the future (now is %d)", start, now.Unix())
+	}
+
+	if latest := now.Add(-minEndAge).Unix(); end > latest {
+		return errors.Errorf("end %d must be at least %s in the past (no later than %d)", end, minEndAge, latest)
+	}
+
+	return nil
+}
+
+// timestampParams returns the query parameters for a request between the start
+// and end timestamps, omitting end and count when they are not set.
+func timestampParams(start int64, end int64, count int) url.Values {
 	params := url.Values{}
 	params.Set("start", strconv.FormatInt(start, 10))
 
@@ -169,17 +1265,38 @@ func (c *Client) GetFromTimestamp(zoneID string, start int64, end int64, count i
 		params.Set("count", strconv.Itoa(count))
 	}
 
-	u, err := c.buildURL(zoneID, params)
+	return params
+}
+
+// FetchFieldNames fetches the names and descriptions of the available log
+// fields, writing them to the client's destination as a single JSON object.
+// The object is written as is: Filter, FieldAliases, SequenceField,
+// PartitionField and Format do not apply to it. Meta.Count is the number of
+// fields. Use ListFieldNames to get them as a map.
+func (c *Client) FetchFieldNames(zoneID string) (*Meta, error) {
+	return c.FetchFieldNamesContext(context.Background(), zoneID)
+}
+
+// FetchFieldNamesContext is FetchFieldNames, aborting the request if ctx is
+// cancelled.
+func (c *Client) FetchFieldNamesContext(ctx context.Context, zoneID string) (*Meta, error) {
+	cl := c.startCall()
+	fields, meta, err := c.fieldNames(ctx, zoneID)
 	if err != nil {
-		return nil, err
+		return cl.finish(meta, err)
 	}
 
-	return c.request(u)
+	// Maps are encoded with sorted keys, so the output is stable.
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return cl.finish(meta, errors.Wrap(err, "failed to encode field names"))
+	}
+
+	return cl.finish(meta, cl.writeLine(c.dest, b))
 }
 
-// FetchFieldNames fetches the names of the available log fields.
-func (c *Client) FetchFieldNames(zoneID string) (*Meta, error) {
-	u, err := url.Parse(
+func (c *Client) fieldsURL(zoneID string) (*url.URL, error) {
+	return url.Parse(
 		fmt.Sprintf(
 			"%s/zones/%s/logs/%s/fields",
 			c.endpoint,
@@ -187,25 +1304,141 @@ func (c *Client) FetchFieldNames(zoneID string) (*Meta, error) {
 			byReceived,
 		),
 	)
+}
+
+// ReplayFromReader streams previously retrieved newline-delimited logs from r
+// to the client's destination, as though they had been returned by the API.
+// This allows archived pulls to be re-processed.
+func (c *Client) ReplayFromReader(r io.Reader) (*Meta, error) {
+	cl := c.startCall()
+	start := c.makeTimestamp()
+	s, err := c.streamLogs(context.Background(), r, cl.writeLog)
+	meta := &Meta{Duration: c.makeTimestamp() - start}
+	s.record(meta)
 	if err != nil {
+		err = errors.Wrap(err, "failed to stream logs")
+	}
+
+	return cl.finish(meta, err)
+}
+
+// DecryptingReader returns a reader decrypting output written with the given
+// Options.EncryptKey, suitable for passing to ReplayFromReader.
+func DecryptingReader(r io.Reader, key []byte) (io.Reader, error) {
+	return encrypt.NewReader(r, key)
+}
+
+// request performs a GET request against the given URL and calls fn for each
+// log in a successful response. Cancelling ctx aborts the request, including
+// while the response is being streamed.
+func (c *Client) request(ctx context.Context, u *url.URL, fn func(log []byte) error) (*Meta, error) {
+	if c.metrics == nil {
+		return c.requestWithRetries(ctx, u, fn)
+	}
+
+	start := c.makeTimestamp()
+	meta, err := c.requestWithRetries(ctx, u, fn)
+	c.observeRequest(time.Duration(c.makeTimestamp()-start)*time.Millisecond, meta, err)
+
+	return meta, err
+}
+
+// breakerRequest makes a single attempt at a request, subject to the circuit
+// breaker.
+func (c *Client) breakerRequest(ctx context.Context, u *url.URL, fn func(log []byte) error) (*Meta, error) {
+	if c.breaker == nil {
+		return c.sendRequest(ctx, u, fn)
+	}
+
+	if err := c.breaker.allow(); err != nil {
 		return nil, err
 	}
-	return c.request(u)
+
+	meta, err := c.sendRequest(ctx, u, fn)
+	if ctx.Err() != nil {
+		// The caller gave up on the request, which says nothing of the
+		// health of the API.
+		c.breaker.release()
+	} else {
+		c.breaker.record(meta, err)
+	}
+
+	return meta, err
+}
+
+func (c *Client) sendRequest(ctx context.Context, u *url.URL, fn func(log []byte) error) (*Meta, error) {
+	if c.flight != nil {
+		return c.coalescedRequest(ctx, u, fn)
+	}
+
+	return c.doRequest(ctx, u, fn)
 }
 
-func (c *Client) request(u *url.URL) (*Meta, error) {
-	req, err := http.NewRequest("GET", u.String(), nil)
+// newRequest returns an authenticated request for u.
+func (c *Client) newRequest(ctx context.Context, method string, u *url.URL, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create a request object")
 	}
 
 	// Apply any user-defined headers in a thread-safe manner.
 	req.Header = cloneHeader(c.headers)
-	req.Header.Set("X-Auth-Key", c.apiKey)
-	req.Header.Set("X-Auth-Email", c.apiEmail)
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", "logshare/"+Version)
+	}
+	if c.apiToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiToken)
+	} else {
+		req.Header.Set("X-Auth-Key", c.apiKey)
+		req.Header.Set("X-Auth-Email", c.apiEmail)
+	}
 	req.Header.Set("Accept", "application/json")
+	if c.gzip {
+		// Setting this ourselves stops net/http from transparently
+		// decompressing the response; see decodeBody.
+		req.Header.Set("Accept-Encoding", strings.Join(acceptEncodings, ", "))
+	}
 
-	start := makeTimestamp()
+	return req, nil
+}
+
+// waitRateLimit blocks until Options.RateLimit allows another request, or ctx
+// is cancelled.
+func (c *Client) waitRateLimit(ctx context.Context) error {
+	if c.limiter == nil {
+		return nil
+	}
+
+	r := c.limiter.Reserve()
+	delay := r.Delay()
+	if delay <= 0 {
+		return nil
+	}
+
+	c.logger.Printf("logshare: waiting %v for the rate limit of %v requests per second", delay, c.limiter.Limit())
+	timer := time.NewTimer(delay)
+	select {
+	case <-ctx.Done():
+		timer.Stop()
+		// Give the slot back, so that later requests need not wait for it.
+		r.Cancel()
+		return errors.Wrap(ctx.Err(), "rate limit wait failed")
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (c *Client) doRequest(ctx context.Context, u *url.URL, fn func(log []byte) error) (*Meta, error) {
+	req, err := c.newRequest(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.waitRateLimit(ctx); err != nil {
+		return nil, err
+	}
+
+	start := c.makeTimestamp()
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, errors.Wrap(err, "HTTP request failed")
@@ -213,65 +1446,312 @@ func (c *Client) request(u *url.URL) (*Meta, error) {
 	defer resp.Body.Close()
 
 	meta := &Meta{
-		StatusCode: resp.StatusCode,
-		Duration:   makeTimestamp() - start,
-		URL:        u.String(),
+		StatusCode:      resp.StatusCode,
+		Duration:        c.makeTimestamp() - start,
+		URL:             u.String(),
+		ContentEncoding: contentEncoding(resp),
+		RateLimit:       parseRateLimit(resp.Header, c.now()),
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode > 299 {
 		// Read errors, but provide a cap on total read size for safety.
 		lr := io.LimitReader(resp.Body, 1000000)
+		meta.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), c.now())
 		body, err := ioutil.ReadAll(lr)
 		if err != nil {
 			return meta, errors.Wrapf(err, "HTTP status %d: request failed", resp.StatusCode)
 		}
 
-		return meta, errors.Errorf("HTTP status %d: request failed: %s", resp.StatusCode, body)
+		return meta, newAPIError(resp.StatusCode, body)
 	}
 
 	// Explicitly handle the 204 No Content case.
-	if resp.StatusCode == 204 {
-		return meta, errors.Errorf("HTTP status %d: no logs available. Check that Log Share is enabled for your domain or that you are not attempting to retrieve logs too quickly", resp.StatusCode)
+	if resp.StatusCode == http.StatusNoContent {
+		return meta, wrapf(ErrNoLogs, "HTTP status %d", resp.StatusCode)
+	}
+
+	if c.strictCT && !isJSONContentType(resp.Header.Get("Content-Type")) {
+		snippet, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return meta, errors.Errorf("HTTP status %d: unexpected Content-Type %q: %s", resp.StatusCode, resp.Header.Get("Content-Type"), snippet)
+	}
+
+	if c.onProgress != nil {
+		tracker := c.newProgressTracker(start)
+		fn = tracker.wrap(fn)
+		defer tracker.report()
+	}
+
+	body, err := decodeBody(resp)
+	if err != nil {
+		return meta, err
+	}
+
+	// Checkpoint the Ray ID of the last log handled successfully, including
+	// logs skipped by the filter, which need not be fetched again.
+	handle := fn
+	fn = func(log []byte) error {
+		err := handle(log)
+		if err != nil && err != errSkipLog {
+			return err
+		}
+
+		if id := rayIDOf(log); id != "" {
+			meta.LastRayID = id
+		}
+		return err
 	}
 
-	// Stream the logs from the response to the destination writer.
-	meta.Count, err = streamLogs(resp.Body, c.dest)
+	// Stream the logs from the response to the handler.
+	s, err := c.streamLogs(ctx, body, fn)
+	s.record(meta)
+	if cerr := body.Close(); err == nil && cerr != nil {
+		err = errors.Wrap(cerr, "failed to decode response")
+	}
 	if err != nil {
-		return meta, errors.Wrap(err, "failed to stream logs")
+		return meta, wrapf(err, "failed to stream logs")
 	}
 
 	return meta, nil
 }
 
-// streamLogs streams newline delimited logs to the provided writer, counting
-// each newline-delimited JSON log without allocating.
+// writeLog writes a single log to the client's destination.
 //
 // An io.MultiWriter can be created to stream logs to two (or more) different
 // sinks: e.g. stdout and a file simultaneously, or a file and a
 // http.ResponseWriter.
-func streamLogs(r io.Reader, w io.Writer) (int, error) {
-	const MB = 1024 * 1024 * 1024
-	var count = 0
+func (c *call) writeLog(log []byte) error {
+	if c.checksum {
+		c.mu.Lock()
+		if c.hasher == nil {
+			c.hasher = sha256.New()
+		}
+		c.hasher.Write(log)
+		c.hasher.Write(newline)
+		c.mu.Unlock()
+	}
 
-	scanner := bufio.NewScanner(r)
+	if c.filter != nil {
+		var record map[string]interface{}
+		if err := json.Unmarshal(log, &record); err != nil {
+			return errors.Wrap(err, "failed to decode log")
+		}
+
+		if !c.filter(record) {
+			return errSkipLog
+		}
+	}
+
+	dest := c.dest
+	target := csvDest{output: -1}
+	if c.partitioner != nil {
+		key, _, err := fieldValue(log, c.partitioner.field)
+		if err != nil {
+			return err
+		}
+		target.partition = key
+
+		if dest, err = c.partitioner.writer(key); err != nil {
+			return err
+		}
+	}
+
+	if c.observer != nil {
+		c.observer.observe(log)
+	}
+
+	if len(c.fieldAliases) > 0 {
+		var err error
+		if log, err = aliasKeys(log, c.fieldAliases); err != nil {
+			return err
+		}
+	}
+
+	if c.sequenceField != "" {
+		log = injectField(log, c.sequenceField, strconv.FormatInt(atomic.AddInt64(&c.seq, 1), 10))
+	}
+
+	if c.canonicalize {
+		var err error
+		if log, err = canonicalizeKeys(log); err != nil {
+			return err
+		}
+	}
+
+	if len(c.outputs) > 0 {
+		for i, out := range c.outputs {
+			formatted, err := c.render(log, out.Format)
+			if err != nil {
+				return err
+			}
+
+			if err := c.writeCSVHeader(out.Writer, csvDest{output: i}, out.Format); err != nil {
+				return err
+			}
+
+			if err := c.writeLine(out.Writer, formatted); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	log, err := c.render(log, c.format)
+	if err != nil {
+		return err
+	}
+
+	if err := c.writeCSVHeader(dest, target, c.format); err != nil {
+		return err
+	}
+
+	return c.writeLine(dest, log)
+}
+
+// writeLine writes log and the line terminator to dest, subject to any write
+// throttle.
+func (c *call) writeLine(dest io.Writer, log []byte) error {
+	// Write the log and its terminator in a single call, so that writers
+	// shared between goroutines (see SyncWriter) never interleave partial logs.
+	line := make([]byte, 0, len(log)+len(c.terminator))
+	line = append(line, log...)
+	line = append(line, c.terminator...)
+
+	start := c.now()
+	defer func() {
+		atomic.AddInt64(&c.writeWait, int64(c.now().Sub(start)))
+	}()
+
+	if c.throttle != nil {
+		c.throttle.wait(len(line))
+	}
+
+	_, err := dest.Write(line)
+	return err
+}
+
+// errSkipLog can be returned by a streamLogs handler to skip a log without
+// failing the stream. Skipped logs are scanned but not counted.
+var errSkipLog = errors.New("log skipped")
+
+// streamed counts the logs read by streamLogs.
+type streamed struct {
+	// The logs passed to the handler, excluding any it skipped.
+	count int
+	// Every log read, including skipped ones.
+	scanned int
+	// The bytes of every log read, counting a newline after each.
+	bytes int64
+	// Whether reading stopped before the end of the logs, because the read
+	// failed or was cancelled.
+	incomplete bool
+}
+
+// record sets the counts in meta.
+func (s streamed) record(meta *Meta) {
+	meta.Count = s.count
+	meta.ScannedCount = s.scanned
+	meta.BytesRead = s.bytes
+	meta.Truncated = meta.Truncated || s.incomplete
+}
+
+var newline = []byte("\n")
+
+// failReader records the first error other than io.EOF returned by r.
+type failReader struct {
+	r   io.Reader
+	err error
+}
+
+func (f *failReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err != nil && err != io.EOF && f.err == nil {
+		f.err = err
+	}
+	return n, err
+}
+
+// streamLogs calls fn for each log read from r, as delimited by the client's
+// split function, counting the logs and bytes read without allocating.
+// Streaming stops at the first error returned by fn, other than errSkipLog, or
+// once ctx is cancelled. If reading r fails, the data after the last complete
+// log is discarded rather than passed to fn.
+func (c *Client) streamLogs(ctx context.Context, r io.Reader, fn func(log []byte) error) (streamed, error) {
+	var s streamed
+
+	fr := &failReader{r: r}
+	scanner := bufio.NewScanner(fr)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		// The scanner treats a failed read like the end of the input, and
+		// would return the start of a log the failure cut short as a final
+		// token. Only split off logs that are known to be complete.
+		if atEOF && fr.err != nil {
+			atEOF = false
+		}
+		return c.split(data, atEOF)
+	})
+	initial := bufio.MaxScanTokenSize
+	if c.maxLineBytes < initial {
+		initial = c.maxLineBytes
+	}
+	scanner.Buffer(make([]byte, 0, initial), c.maxLineBytes)
 
-	// TODO: Consider a buffer pool to read the track the last log read, for
-	// checkpointing the rayID.
 	for scanner.Scan() {
-		w.Write(scanner.Bytes())
-		w.Write([]byte("\n"))
-		count++
+		if err := ctx.Err(); err != nil {
+			s.incomplete = true
+			return s, err
+		}
+
+		// Skip blank lines, such as trailing newlines at the end of a
+		// response, so that they are not counted or written as logs.
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		s.scanned++
+		s.bytes += int64(len(line)) + 1
+
+		if err := fn(line); err == errSkipLog {
+			continue
+		} else if err != nil {
+			return s, err
+		}
+		s.count++
 	}
 
 	if err := scanner.Err(); err != nil {
-		return count, errors.Wrap(err, "reading response:")
+		s.incomplete = true
+		// A cancelled request fails the body read; report the cancellation
+		// rather than the read error it caused.
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return s, ctxErr
+		}
+		return s, errors.Wrap(err, "reading response")
+	}
+
+	return s, nil
+}
+
+// isJSONContentType reports whether contentType is a JSON or NDJSON media type.
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch mediaType {
+	case "application/json", "application/x-ndjson", "application/ndjson", "application/x-json-stream":
+		return true
 	}
 
-	return count, nil
+	return strings.HasSuffix(mediaType, "+json")
 }
 
-func makeTimestamp() int64 {
-	return time.Now().UnixNano() / (int64(time.Millisecond) / int64(time.Nanosecond))
+// makeTimestamp returns the current time in milliseconds, as reported by the
+// client's clock.
+func (c *Client) makeTimestamp() int64 {
+	return c.now().UnixNano() / (int64(time.Millisecond) / int64(time.Nanosecond))
 }
 
 // cloneHeader returns a shallow copy of the header.
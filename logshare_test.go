@@ -0,0 +1,720 @@
+package logshare
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// newTestServer returns a server answering every request with body.
+func newTestServer(t *testing.T, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}))
+}
+
+func TestChecksum(t *testing.T) {
+	ts := newTestServer(t, "{\"a\":1}\n\n{\"a\":2}\n")
+	defer ts.Close()
+
+	client, err := New("key", "email", &Options{ApiURL: ts.URL + "/", Dest: ioutil.Discard, Checksum: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256([]byte("{\"a\":1}\n{\"a\":2}\n"))
+	want := hex.EncodeToString(sum[:])
+
+	// A call that does not write to the destination must not leak into the
+	// checksum of the next one.
+	if _, _, err := client.DistinctValues("zone", 1, 2, "a", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		meta, err := client.GetFromRayID("zone", "ray")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta.Checksum != want {
+			t.Fatalf("call %d: got checksum %q, want %q", i, meta.Checksum, want)
+		}
+	}
+
+	client, err = New("key", "email", &Options{ApiURL: ts.URL + "/", Dest: ioutil.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := client.GetFromRayID("zone", "ray")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Checksum != "" {
+		t.Fatalf("got checksum %q without Options.Checksum", meta.Checksum)
+	}
+}
+
+func TestFetchFieldNamesSkipsPipeline(t *testing.T) {
+	ts := newTestServer(t, `{"ClientIP":"Client IP","EdgeStartTimestamp":"Start time"}`)
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	client, err := New("key", "email", &Options{
+		ApiURL:        ts.URL + "/",
+		Dest:          &buf,
+		Format:        FormatCSV,
+		Fields:        []string{"ClientIP"},
+		SequenceField: "Seq",
+		Filter:        func(map[string]interface{}) bool { return false },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := client.FetchFieldNames("zone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Count != 2 {
+		t.Errorf("got Count %d, want 2", meta.Count)
+	}
+
+	want := `{"ClientIP":"Client IP","EdgeStartTimestamp":"Start time"}` + "\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestGetFromRayIDFiltered(t *testing.T) {
+	ts := newTestServer(t, "{\"RayID\":\"ray\"}\n")
+	defer ts.Close()
+
+	client, err := New("key", "email", &Options{
+		ApiURL: ts.URL + "/",
+		Dest:   ioutil.Discard,
+		Filter: func(map[string]interface{}) bool { return false },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The log was found, even though Filter skipped it.
+	meta, err := client.GetFromRayID("zone", "ray")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Count != 0 || meta.ScannedCount != 1 {
+		t.Errorf("got Count %d and ScannedCount %d, want 0 and 1", meta.Count, meta.ScannedCount)
+	}
+
+	empty := newTestServer(t, "")
+	defer empty.Close()
+
+	client, err = New("key", "email", &Options{ApiURL: empty.URL + "/", Dest: ioutil.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetFromRayID("zone", "ray"); errors.Cause(err) != ErrNoLogs {
+		t.Errorf("got error %v, want ErrNoLogs", err)
+	}
+}
+
+func TestAllFieldsListingFailure(t *testing.T) {
+	var listings int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/fields") {
+			listings++
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if fields := r.URL.Query().Get("fields"); fields != "" {
+			t.Errorf("got fields %q, want the default fields", fields)
+		}
+		fmt.Fprint(w, "{}\n")
+	}))
+	defer ts.Close()
+
+	client, err := New("key", "email", &Options{
+		ApiURL:      ts.URL + "/",
+		Dest:        ioutil.Discard,
+		AllFields:   true,
+		RetryPolicy: &RetryPolicy{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := client.GetFromTimeRange("zone", 0, 180, time.Minute, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listings != 1 {
+		t.Errorf("got %d listings, want 1", listings)
+	}
+	if len(meta.Warnings) != 1 {
+		t.Errorf("got warnings %q, want one", meta.Warnings)
+	}
+}
+
+func TestAllFieldsWarningsPerCall(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/zones/bad/logs/received/fields"):
+			w.WriteHeader(http.StatusInternalServerError)
+		case strings.HasSuffix(r.URL.Path, "/fields"):
+			fmt.Fprint(w, `{"ClientIP":"Client IP"}`)
+		default:
+			fmt.Fprint(w, "{}\n")
+		}
+	}))
+	defer ts.Close()
+
+	client, err := New("key", "email", &Options{
+		ApiURL:      ts.URL + "/",
+		Dest:        ioutil.Discard,
+		AllFields:   true,
+		RetryPolicy: &RetryPolicy{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A warning belongs to the call that raised it, even while other calls
+	// on the same Client are in flight.
+	const calls = 8
+	warnings := make(chan string, calls)
+	for i := 0; i < calls; i++ {
+		zoneID := "good"
+		if i%2 == 0 {
+			zoneID = "bad"
+		}
+		go func(zoneID string) {
+			meta, err := client.GetFromTimestamp(zoneID, 1, 2, 0)
+			if err != nil {
+				warnings <- fmt.Sprintf("%s: %v", zoneID, err)
+				return
+			}
+			warnings <- fmt.Sprintf("%s: %d", zoneID, len(meta.Warnings))
+		}(zoneID)
+	}
+
+	for i := 0; i < calls; i++ {
+		switch got := <-warnings; got {
+		case "bad: 1", "good: 0":
+		default:
+			t.Errorf("got %s, want one warning for bad and none for good", got)
+		}
+	}
+}
+
+func TestGetFromTimestampFuncWarnings(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/fields") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, "{}\n")
+	}))
+	defer ts.Close()
+
+	client, err := New("key", "email", &Options{
+		ApiURL:      ts.URL + "/",
+		AllFields:   true,
+		RetryPolicy: &RetryPolicy{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logs := 0
+	meta, err := client.GetFromTimestampFunc("zone", 1, 2, 0, func(log []byte) error {
+		logs++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logs != 1 || meta.Count != 1 {
+		t.Errorf("got %d logs and a count of %d, want 1", logs, meta.Count)
+	}
+	if len(meta.Warnings) != 1 {
+		t.Errorf("got warnings %q, want the failed field listing", meta.Warnings)
+	}
+}
+
+func TestNewTimestampFormat(t *testing.T) {
+	for _, format := range []TimestampFormat{"", Unix, UnixNano, RFC3339} {
+		if _, err := New("key", "email", &Options{TimestampFormat: format}); err != nil {
+			t.Errorf("TimestampFormat %q: %v", format, err)
+		}
+	}
+
+	if _, err := New("key", "email", &Options{TimestampFormat: "rfc339"}); err == nil {
+		t.Error("expected an error for an unknown TimestampFormat")
+	}
+}
+
+func TestParseTimestampFormat(t *testing.T) {
+	for _, s := range []string{"unix", "unixnano", "rfc3339"} {
+		format, err := ParseTimestampFormat(s)
+		if err != nil || string(format) != s {
+			t.Errorf("%q: got %q, %v", s, format, err)
+		}
+	}
+
+	for _, s := range []string{"", "RFC3339", "unix-nano"} {
+		if _, err := ParseTimestampFormat(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestGetFromRayIDs(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/missing") {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		fmt.Fprint(w, "{\"RayID\":\"ray\"}\n")
+	}))
+	defer ts.Close()
+
+	client, err := New("key", "email", &Options{ApiURL: ts.URL + "/", Dest: ioutil.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Blank and repeated Ray IDs are skipped.
+	meta, err := client.GetFromRayIDs("zone", []string{"a", "", "b", "a", "missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Count != 2 || meta.BytesRead != 32 {
+		t.Errorf("got Count %d and BytesRead %d, want 2 and 32", meta.Count, meta.BytesRead)
+	}
+	if len(meta.Warnings) != 1 {
+		t.Errorf("got warnings %q, want one for the missing ray ID", meta.Warnings)
+	}
+
+	if _, err := client.GetFromRayIDs("zone", []string{"missing"}); errors.Cause(err) != ErrNoLogs {
+		t.Errorf("got error %v, want ErrNoLogs", err)
+	}
+}
+
+func TestCountOrder(t *testing.T) {
+	var query url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		for i := 1; i <= 5; i++ {
+			fmt.Fprintf(w, "{\"a\":%d}\n", i)
+		}
+	}))
+	defer ts.Close()
+
+	// The test server ignores count, so CountFirst writes every log sent,
+	// while CountLast trims them to the last ones itself.
+	tests := []struct {
+		order     CountOrder
+		wantCount string
+		want      string
+	}{
+		{"", "2", "{\"a\":1}\n{\"a\":2}\n{\"a\":3}\n{\"a\":4}\n{\"a\":5}\n"},
+		{CountFirst, "2", "{\"a\":1}\n{\"a\":2}\n{\"a\":3}\n{\"a\":4}\n{\"a\":5}\n"},
+		{CountLast, "", "{\"a\":4}\n{\"a\":5}\n"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		client, err := New("key", "email", &Options{ApiURL: ts.URL + "/", Dest: &buf, CountOrder: tt.order})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		meta, err := client.GetFromTimestamp("zone", 1000, 1060, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := query.Get("count"); got != tt.wantCount {
+			t.Errorf("%q: got count %q, want %q", tt.order, got, tt.wantCount)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.order, buf.String(), tt.want)
+		}
+		if wantCount := strings.Count(tt.want, "\n"); meta.Count != wantCount || !meta.Truncated {
+			t.Errorf("%q: got Count %d and Truncated %v, want %d and true", tt.order, meta.Count, meta.Truncated, wantCount)
+		}
+	}
+}
+
+func TestLineTerminator(t *testing.T) {
+	ts := newTestServer(t, "{\"a\":1}\n{\"a\":2}\n{\"a\":3}\n")
+	defer ts.Close()
+
+	// The terminator follows every log and the CSV header row, but is not
+	// counted as a log.
+	tests := []struct {
+		format     OutputFormat
+		terminator string
+		want       string
+	}{
+		{FormatJSON, "\x00", "{\"a\":1}\x00{\"a\":2}\x00{\"a\":3}\x00"},
+		{FormatJSON, "\n\n", "{\"a\":1}\n\n{\"a\":2}\n\n{\"a\":3}\n\n"},
+		{FormatCSV, "\r\n", "a\r\n1\r\n2\r\n3\r\n"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		client, err := New("key", "email", &Options{
+			ApiURL:         ts.URL + "/",
+			Dest:           &buf,
+			Format:         tt.format,
+			Fields:         []string{"a"},
+			LineTerminator: []byte(tt.terminator),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		meta, err := client.GetFromTimestamp("zone", 1, 2, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%s, terminator %q: got %q, want %q", tt.format, tt.terminator, buf.String(), tt.want)
+		}
+		if meta.Count != 3 {
+			t.Errorf("%s, terminator %q: got Count %d, want 3", tt.format, tt.terminator, meta.Count)
+		}
+	}
+}
+
+func TestNewApiURL(t *testing.T) {
+	tests := []struct {
+		apiURL string
+		want   string
+	}{
+		{"", "https://api.cloudflare.com/client/v4/zones/zone/logs/received?"},
+		{"https://staging.example.com/client/v4", "https://staging.example.com/client/v4/zones/zone/logs/received?"},
+		{"https://staging.example.com/client/v4/", "https://staging.example.com/client/v4/zones/zone/logs/received?"},
+	}
+
+	for _, tt := range tests {
+		client, err := New("key", "email", &Options{ApiURL: tt.apiURL})
+		if err != nil {
+			t.Fatalf("ApiURL %q: %v", tt.apiURL, err)
+		}
+
+		u, err := client.BuildRequestURL("zone", 1, 2, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(u, tt.want) {
+			t.Errorf("ApiURL %q: got %q, want a URL starting with %q", tt.apiURL, u, tt.want)
+		}
+	}
+}
+
+func TestNewApiURLScheme(t *testing.T) {
+	tests := []struct {
+		apiURL string
+		ok     bool
+	}{
+		{"https://api.example.com/client/v4", true},
+		{"http://127.0.0.1:8080/client/v4", true},
+		{"HTTP://localhost/client/v4", true},
+		{"ftp://api.example.com/client/v4", false},
+		{"api.example.com/client/v4", false},
+		{"://api.example.com", false},
+	}
+
+	for _, tt := range tests {
+		_, err := New("key", "email", &Options{ApiURL: tt.apiURL})
+		if tt.ok && err != nil {
+			t.Errorf("ApiURL %q: unexpected error: %v", tt.apiURL, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("ApiURL %q: expected an error", tt.apiURL)
+		}
+	}
+
+	// httptest servers listen on plain http.
+	ts := newTestServer(t, "{\"a\":1}\n")
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	client, err := New("key", "email", &Options{ApiURL: ts.URL, Dest: &buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := client.GetFromTimestamp("zone", 1, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(meta.URL, "http://") || buf.String() != "{\"a\":1}\n" {
+		t.Fatalf("got URL %q and logs %q", meta.URL, buf.String())
+	}
+}
+
+func TestRetentionWindow(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, "{\"a\":1}\n")
+	}))
+	defer ts.Close()
+
+	client, err := New("key", "email", &Options{ApiURL: ts.URL, Dest: ioutil.Discard, RetentionWindow: 7 * 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(30*24*3600, 0)
+	client.now = func() time.Time { return now }
+
+	start := now.Add(-8 * 24 * time.Hour).Unix()
+	if _, err := client.GetFromTimestamp("zone", start, start+60, 0); errors.Cause(err) != ErrBeyondRetention {
+		t.Fatalf("got %v, want ErrBeyondRetention", err)
+	}
+	if requests != 0 {
+		t.Fatalf("got %d requests for a window beyond retention, want none", requests)
+	}
+
+	start = now.Add(-6 * 24 * time.Hour).Unix()
+	if _, err := client.GetFromTimestamp("zone", start, start+60, 0); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 {
+		t.Fatalf("got %d requests, want 1", requests)
+	}
+
+	// Without RetentionWindow, old windows are requested as usual.
+	client, err = New("key", "email", &Options{ApiURL: ts.URL, Dest: ioutil.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.now = func() time.Time { return now }
+
+	start = now.Add(-20 * 24 * time.Hour).Unix()
+	if _, err := client.GetFromTimestamp("zone", start, start+60, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBlankLines(t *testing.T) {
+	ts := newTestServer(t, "{\"a\":1}\n\n{\"a\":2}\n \t\n\n\n")
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	client, err := New("key", "email", &Options{ApiURL: ts.URL, Dest: &buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := client.GetFromTimestamp("zone", 1, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Count != 2 {
+		t.Errorf("got count %d, want 2", meta.Count)
+	}
+	if want := "{\"a\":1}\n{\"a\":2}\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestTreatEmptyAsError(t *testing.T) {
+	empty := newTestServer(t, "")
+	defer empty.Close()
+	var probes int32
+	noContent := newEntitlementServer(http.StatusOK, &probes)
+	defer noContent.Close()
+
+	tests := []struct {
+		server       *httptest.Server
+		emptyAsError bool
+		wantStatus   int
+		wantErr      error
+	}{
+		{empty, false, http.StatusOK, nil},
+		{empty, true, http.StatusOK, ErrNoLogs},
+		{noContent, false, http.StatusNoContent, ErrNoLogs},
+		{noContent, true, http.StatusNoContent, ErrNoLogs},
+	}
+
+	for _, tt := range tests {
+		client, err := New("key", "email", &Options{ApiURL: tt.server.URL, Dest: ioutil.Discard, TreatEmptyAsError: tt.emptyAsError})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		meta, err := client.GetFromTimestamp("zone", 1, 2, 0)
+		if errors.Cause(err) != tt.wantErr {
+			t.Errorf("status %d, TreatEmptyAsError %v: got error %v, want %v", tt.wantStatus, tt.emptyAsError, err, tt.wantErr)
+			continue
+		}
+		if meta == nil || meta.StatusCode != tt.wantStatus || meta.Count != 0 {
+			t.Errorf("status %d, TreatEmptyAsError %v: got meta %+v", tt.wantStatus, tt.emptyAsError, meta)
+		}
+
+		// Empty windows are skipped when walking a range, either way.
+		if _, err := client.GetFromTimeRange("zone", 1, 121, time.Minute, 0); err != nil {
+			t.Errorf("status %d, TreatEmptyAsError %v: range: %v", tt.wantStatus, tt.emptyAsError, err)
+		}
+	}
+}
+
+func TestMaxLogLineBytes(t *testing.T) {
+	big := "{\"RequestHeaders\":\"" + strings.Repeat("x", 100<<10) + "\"}"
+	ts := newTestServer(t, big+"\n{\"a\":1}\n")
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	client, err := New("key", "email", &Options{ApiURL: ts.URL, Dest: &buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := client.GetFromTimestamp("zone", 1, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Count != 2 || buf.String() != big+"\n{\"a\":1}\n" {
+		t.Fatalf("got count %d and %d bytes", meta.Count, buf.Len())
+	}
+
+	client, err = New("key", "email", &Options{ApiURL: ts.URL, Dest: ioutil.Discard, MaxLogLineBytes: 64 << 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetFromTimestamp("zone", 1, 2, 0); err == nil {
+		t.Fatal("expected an error for a log longer than MaxLogLineBytes")
+	}
+
+	if _, err := New("key", "email", &Options{MaxLogLineBytes: -1}); err == nil {
+		t.Fatal("expected an error for a negative MaxLogLineBytes")
+	}
+}
+
+func TestSample(t *testing.T) {
+	tests := []struct {
+		sample float64
+		want   string
+	}{
+		{0.25, "0.25"},
+		{0.05, "0.05"},
+		{0.01, "0.01"},
+		{0.1, "0.1"},
+		{1, "1"},
+	}
+
+	for _, tt := range tests {
+		client, err := New("key", "email", &Options{Sample: tt.sample})
+		if err != nil {
+			t.Fatalf("sample %v: %v", tt.sample, err)
+		}
+
+		u, err := client.startCall().buildURL("zone", timestampParams(1, 2, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := u.Query().Get("sample"); got != tt.want {
+			t.Errorf("sample %v: got sample=%s, want sample=%s", tt.sample, got, tt.want)
+		}
+	}
+
+	for _, sample := range []float64{-0.1, 1.5} {
+		if _, err := New("key", "email", &Options{Sample: sample}); err == nil {
+			t.Errorf("sample %v: expected an error", sample)
+		}
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	agents := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents <- r.Header.Get("User-Agent")
+		fmt.Fprint(w, "{\"a\":1}\n")
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		headers http.Header
+		want    string
+	}{
+		{nil, "logshare/" + Version},
+		{http.Header{"X-Custom": {"value"}}, "logshare/" + Version},
+		{http.Header{"User-Agent": {"my-puller/1.0"}}, "my-puller/1.0"},
+	}
+
+	for _, tt := range tests {
+		client, err := New("key", "email", &Options{ApiURL: ts.URL, Dest: ioutil.Discard, Headers: tt.headers})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.GetFromRayID("zone", "ray"); err != nil {
+			t.Fatal(err)
+		}
+		if got := <-agents; got != tt.want {
+			t.Errorf("headers %v: got User-Agent %q, want %q", tt.headers, got, tt.want)
+		}
+	}
+}
+
+func TestConcurrentCalls(t *testing.T) {
+	const workers = 8
+
+	ts := newTestServer(t, "{\"a\":1}\n{\"a\":2}\n{\"a\":3}\n")
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	client, err := New("key", "email", &Options{
+		ApiURL:        ts.URL,
+		Dest:          NewSyncWriter(&buf),
+		SequenceField: "seq",
+		Checksum:      true,
+		ObserveFields: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256([]byte("{\"a\":1}\n{\"a\":2}\n{\"a\":3}\n"))
+	want := hex.EncodeToString(sum[:])
+
+	// Calls on one Client share nothing but its configuration, so each
+	// reports its own checksum, observed fields and sequence numbers.
+	metas := make(chan *Meta, workers)
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			meta, err := client.GetFromTimestamp("zone", 1, 2, 0)
+			metas <- meta
+			errs <- err
+		}()
+	}
+
+	for i := 0; i < workers; i++ {
+		meta, err := <-metas, <-errs
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta.Count != 3 || meta.Checksum != want || strings.Join(meta.ObservedFields, ",") != "a" {
+			t.Fatalf("got meta %+v", meta)
+		}
+	}
+
+	for seq := 1; seq <= 3; seq++ {
+		if n := strings.Count(buf.String(), fmt.Sprintf("{\"seq\":%d,", seq)); n != workers {
+			t.Errorf("got sequence number %d %d times, want %d", seq, n, workers)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package logshare
+
+import "time"
+
+// Metrics receives measurements of the requests a Client makes, e.g. to export
+// them to a monitoring system. The github.com/cloudflare/logshare/prometheus
+// package provides a Prometheus implementation, so that the library itself
+// does not depend on a metrics client.
+type Metrics interface {
+	// ObserveRequest is called once for each request to the API, after any
+	// retries, with how long it took, the number of logs it streamed and the
+	// status code of its last response (0 if none was received). err is the
+	// request's error, or nil if it succeeded.
+	ObserveRequest(duration time.Duration, count int, statusCode int, err error)
+}
+
+// observeRequest reports a request returning meta and err to the client's
+// Metrics.
+func (c *Client) observeRequest(duration time.Duration, meta *Meta, err error) {
+	var count, status int
+	if meta != nil {
+		count = meta.Count
+		status = meta.StatusCode
+	}
+
+	c.metrics.ObserveRequest(duration, count, status, err)
+}
@@ -0,0 +1,85 @@
+package logshare
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// defaultConcurrency is the default Options.Concurrency.
+const defaultConcurrency = 4
+
+// GetFromTimestampMulti fetches logs between the start and end timestamps for
+// each of the zones, as GetFromTimestamp does, fetching up to
+// Options.Concurrency zones at once. Logs from every zone are written to the
+// client's destination: each log is written whole by a single call, and calls
+// are serialized, so logs from different zones never interleave mid-line,
+// though their order across zones is undefined.
+//
+// It returns the Meta of each zone that was requested, keyed by zone ID, and
+// the errors of any zones that failed, combined. A failing zone does not stop
+// the others. It cannot be used with Options.DestByKey.
+func (c *Client) GetFromTimestampMulti(zoneIDs []string, start int64, end int64, count int) (map[string]*Meta, error) {
+	if c.partitioner != nil {
+		return nil, errors.New("GetFromTimestampMulti cannot be used with DestByKey")
+	}
+
+	// Zones are fetched by a clone writing through a shared lock on each
+	// destination, each as a call of its own.
+	base := c.Clone()
+	base.dest = syncWriter(c.dest)
+	base.outputs = make([]OutputSpec, len(c.outputs))
+	for i, out := range c.outputs {
+		base.outputs[i] = OutputSpec{Writer: syncWriter(out.Writer), Format: out.Format}
+	}
+
+	var (
+		mu    sync.Mutex
+		metas = make(map[string]*Meta, len(zoneIDs))
+		errs  []error
+		wg    sync.WaitGroup
+		sem   = make(chan struct{}, c.concurrency)
+	)
+
+	for _, zoneID := range zoneIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(zoneID string, cl *call) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			meta, err := cl.finish(cl.getFromTimestampCount(context.Background(), zoneID, start, end, count))
+
+			mu.Lock()
+			defer mu.Unlock()
+			if meta != nil {
+				metas[zoneID] = meta
+			}
+			if err != nil {
+				errs = append(errs, errors.Wrapf(err, "zone %s", zoneID))
+			}
+		}(zoneID, base.startCall())
+	}
+	wg.Wait()
+
+	// Close any destination the client owns, now every zone is done.
+	if err := c.closeOwned(nil); err != nil {
+		errs = append(errs, err)
+	}
+
+	return metas, combineErrors(errs)
+}
+
+// syncWriter returns w serialized by a SyncWriter, unless it already is.
+func syncWriter(w io.Writer) io.Writer {
+	if _, ok := w.(*SyncWriter); ok {
+		return w
+	}
+
+	return NewSyncWriter(w)
+}
@@ -0,0 +1,47 @@
+package logshare
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+// fieldObserver collects the top-level keys of the logs written during a call,
+// for Meta.ObservedFields. It is safe for concurrent use.
+type fieldObserver struct {
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+func newFieldObserver() *fieldObserver {
+	return &fieldObserver{seen: make(map[string]struct{})}
+}
+
+// observe records the keys of log. Logs that are not JSON objects are ignored.
+func (o *fieldObserver) observe(log []byte) {
+	var record map[string]json.RawMessage
+	if err := json.Unmarshal(log, &record); err != nil {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for key := range record {
+		o.seen[key] = struct{}{}
+	}
+}
+
+// take returns the sorted keys observed so far and starts afresh.
+func (o *fieldObserver) take() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	fields := make([]string, 0, len(o.seen))
+	for key := range o.seen {
+		fields = append(fields, key)
+	}
+	sort.Strings(fields)
+	o.seen = make(map[string]struct{})
+
+	return fields
+}
@@ -0,0 +1,42 @@
+package logshare
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestObserveFields(t *testing.T) {
+	ts := newTestServer(t, "{\"ClientIP\":\"192.0.2.1\"}\n{\"RayID\":\"ray\",\"ClientIP\":\"192.0.2.2\"}\nnot json\n{\"WAFAction\":null}\n")
+	defer ts.Close()
+
+	client, err := New("key", "email", &Options{ApiURL: ts.URL, Dest: ioutil.Discard, ObserveFields: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The fields of every window are collected, and start afresh on the next
+	// call.
+	for i := 0; i < 2; i++ {
+		meta, err := client.GetFromTimeRange("zone", 0, 120, time.Minute, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"ClientIP", "RayID", "WAFAction"}; !reflect.DeepEqual(meta.ObservedFields, want) {
+			t.Fatalf("call %d: got %v, want %v", i, meta.ObservedFields, want)
+		}
+	}
+
+	client, err = New("key", "email", &Options{ApiURL: ts.URL, Dest: ioutil.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := client.GetFromTimestamp("zone", 1, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.ObservedFields != nil {
+		t.Fatalf("got %v without ObserveFields", meta.ObservedFields)
+	}
+}
@@ -0,0 +1,43 @@
+package logshare
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// knownParams are the query parameters of the Logpull API that ExtraParams may
+// set without being listed in Options.AllowedExtraParams.
+var knownParams = map[string]bool{
+	"start":      true,
+	"end":        true,
+	"count":      true,
+	"sample":     true,
+	"fields":     true,
+	"timestamps": true,
+	"start_id":   true,
+	"end_id":     true,
+}
+
+// checkExtraParams returns an error naming any extra query parameters that are
+// neither known Logpull parameters nor explicitly allowed, unless the client
+// is lax about parameters.
+func (c *Client) checkExtraParams() error {
+	if c.laxParams {
+		return nil
+	}
+
+	var unknown []string
+	for key := range c.extraParams {
+		if !knownParams[key] && !c.allowedParams[key] {
+			unknown = append(unknown, key)
+		}
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return errors.Errorf("unknown query parameters %q: add them to AllowedExtraParams or set LaxParams", unknown)
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package logshare
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestCheckExtraParams(t *testing.T) {
+	tests := []struct {
+		params  url.Values
+		allowed []string
+		lax     bool
+		ok      bool
+	}{
+		{url.Values{"sample": {"0.1"}}, nil, false, true},
+		{url.Values{"smaple": {"0.1"}}, nil, false, false},
+		{url.Values{"smaple": {"0.1"}}, nil, true, true},
+		{url.Values{"experimental": {"1"}}, []string{"experimental"}, false, true},
+		{url.Values{"experimental": {"1"}, "other": {"1"}}, []string{"experimental"}, false, false},
+	}
+
+	for _, tt := range tests {
+		client, err := New("key", "email", &Options{ExtraParams: tt.params, AllowedExtraParams: tt.allowed, LaxParams: tt.lax})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = client.startCall().buildURL("zone", timestampParams(1, 2, 0))
+		if tt.ok && err != nil {
+			t.Errorf("%v (allowed %v, lax %v): unexpected error: %v", tt.params, tt.allowed, tt.lax, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("%v (allowed %v, lax %v): expected an error", tt.params, tt.allowed, tt.lax)
+		}
+	}
+}
+
+func TestExtraParams(t *testing.T) {
+	client, err := New("key", "email", &Options{
+		Fields:             []string{"ClientIP"},
+		ExtraParams:        url.Values{"experimental": {"a b", "c&d"}, "count": {"5"}, "fields": {"RayID"}},
+		AllowedExtraParams: []string{"experimental"},
+		OverrideParams:     []string{"fields"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := client.startCall().buildURL("zone", timestampParams(1, 2, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Extra parameters survive encoding the query; those the package sets win
+	// unless overridden.
+	q, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := q["experimental"]; len(got) != 2 || got[0] != "a b" || got[1] != "c&d" {
+		t.Errorf("got experimental=%q, want both values", got)
+	}
+	if got := q.Get("count"); got != "10" {
+		t.Errorf("got count=%s, want the package's 10", got)
+	}
+	if got := q.Get("fields"); got != "RayID" {
+		t.Errorf("got fields=%s, want the overridden RayID", got)
+	}
+	if got := q.Get("start"); got != "1" {
+		t.Errorf("got start=%s, want 1", got)
+	}
+
+	if _, err := New("key", "email", &Options{OverrideParams: []string{"fields"}}); err == nil {
+		t.Fatal("expected an error for an override missing from ExtraParams")
+	}
+}
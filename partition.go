@@ -0,0 +1,79 @@
+package logshare
+
+import (
+	"container/list"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const defaultMaxOpenPartitions = 16
+
+// partitioner routes logs to per-key writers, keeping at most max writers open
+// and closing the least recently used when another is needed.
+type partitioner struct {
+	field   string
+	open    func(key string) (io.WriteCloser, error)
+	max     int
+	lru     *list.List
+	writers map[string]*list.Element
+}
+
+type partition struct {
+	key string
+	w   io.WriteCloser
+}
+
+func newPartitioner(field string, open func(key string) (io.WriteCloser, error), max int) *partitioner {
+	return &partitioner{
+		field:   field,
+		open:    open,
+		max:     max,
+		lru:     list.New(),
+		writers: make(map[string]*list.Element),
+	}
+}
+
+// writer returns the writer for key, opening it (and closing the least
+// recently used writer, if at the limit) when it is not already open.
+func (p *partitioner) writer(key string) (io.Writer, error) {
+	if elem, ok := p.writers[key]; ok {
+		p.lru.MoveToFront(elem)
+		return elem.Value.(*partition).w, nil
+	}
+
+	if p.lru.Len() >= p.max {
+		oldest := p.lru.Back()
+		part := oldest.Value.(*partition)
+		p.lru.Remove(oldest)
+		delete(p.writers, part.key)
+
+		if err := part.w.Close(); err != nil {
+			return nil, errors.Wrapf(err, "failed to close partition %q", part.key)
+		}
+	}
+
+	w, err := p.open(key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open partition %q", key)
+	}
+
+	p.writers[key] = p.lru.PushFront(&partition{key: key, w: w})
+	return w, nil
+}
+
+// closeAll closes every open writer, returning any errors combined.
+func (p *partitioner) closeAll() error {
+	var errs []error
+	for elem := p.lru.Front(); elem != nil; elem = elem.Next() {
+		part := elem.Value.(*partition)
+		if err := part.w.Close(); err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to close partition %q", part.key))
+		}
+	}
+
+	p.lru.Init()
+	p.writers = make(map[string]*list.Element)
+
+	return combineErrors(errs)
+}
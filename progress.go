@@ -0,0 +1,91 @@
+package logshare
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+const defaultProgressInterval = time.Second
+
+// Progress describes how far a request has got streaming logs.
+type Progress struct {
+	// The number of logs streamed so far.
+	Count int `json:"count"`
+	// The number of bytes streamed so far, including the line terminator
+	// after each log (see Options.LineTerminator).
+	Bytes int64 `json:"bytes"`
+	// Milliseconds elapsed since the request was sent.
+	ElapsedMS int64 `json:"elapsed_ms"`
+}
+
+// progressWriterFunc returns an OnProgress callback that writes each Progress
+// to w as a line of JSON.
+func progressWriterFunc(w io.Writer) func(Progress) {
+	enc := json.NewEncoder(w)
+	return func(p Progress) {
+		enc.Encode(p)
+	}
+}
+
+// chainProgress returns a callback calling each non-nil callback in turn.
+func chainProgress(fns ...func(Progress)) func(Progress) {
+	var chain []func(Progress)
+	for _, fn := range fns {
+		if fn != nil {
+			chain = append(chain, fn)
+		}
+	}
+
+	switch len(chain) {
+	case 0:
+		return nil
+	case 1:
+		return chain[0]
+	}
+
+	return func(p Progress) {
+		for _, fn := range chain {
+			fn(p)
+		}
+	}
+}
+
+// progressTracker counts logs passing through a handler, reporting progress
+// to the client's OnProgress callback every progressInterval.
+type progressTracker struct {
+	c        *Client
+	start    int64
+	reported int64
+	progress Progress
+}
+
+func (c *Client) newProgressTracker(start int64) *progressTracker {
+	return &progressTracker{c: c, start: start, reported: start}
+}
+
+// wrap returns a handler that records progress for each log before passing it
+// on to fn.
+func (t *progressTracker) wrap(fn func(log []byte) error) func(log []byte) error {
+	return func(log []byte) error {
+		if err := fn(log); err != nil {
+			return err
+		}
+
+		t.progress.Count++
+		t.progress.Bytes += int64(len(log) + len(t.c.terminator))
+
+		if now := t.c.makeTimestamp(); now-t.reported >= int64(t.c.progressInterval/time.Millisecond) {
+			t.reported = now
+			t.report()
+		}
+
+		return nil
+	}
+}
+
+// report calls the OnProgress callback with the current progress.
+func (t *progressTracker) report() {
+	t.progress.ElapsedMS = t.c.makeTimestamp() - t.start
+	t.c.onProgress(t.progress)
+}
@@ -0,0 +1,45 @@
+package logshare
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLineTerminatorProgress(t *testing.T) {
+	ts := newTestServer(t, "{\"a\":1}\n{\"a\":2}\n")
+	defer ts.Close()
+
+	tests := []struct {
+		terminator string
+		want       string
+	}{
+		{"\n", "{\"a\":1}\n{\"a\":2}\n"},
+		{"\r\n", "{\"a\":1}\r\n{\"a\":2}\r\n"},
+		{"", "{\"a\":1}{\"a\":2}"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		var last Progress
+		client, err := New("key", "email", &Options{
+			ApiURL:         ts.URL + "/",
+			Dest:           &buf,
+			LineTerminator: []byte(tt.terminator),
+			OnProgress:     func(p Progress) { last = p },
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		meta, err := client.GetFromRayID("zone", "ray")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta.Count != 2 || buf.String() != tt.want {
+			t.Errorf("terminator %q: got Count %d and %q, want 2 and %q", tt.terminator, meta.Count, buf.String(), tt.want)
+		}
+		if last.Count != 2 || last.Bytes != int64(len(tt.want)) {
+			t.Errorf("terminator %q: got progress %+v, want 2 logs and %d bytes", tt.terminator, last, len(tt.want))
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Package prometheus records the requests made by a logshare.Client as
+// Prometheus metrics.
+//
+//	metrics, err := prometheus.New(prom.DefaultRegisterer)
+//	...
+//	client, err := logshare.New(apiKey, apiEmail, &logshare.Options{
+//		Metrics: metrics,
+//	})
+package prometheus
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/cloudflare/logshare"
+	"github.com/pkg/errors"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics implements logshare.Metrics, recording:
+//
+//   - logshare_request_duration_seconds, a histogram of request durations;
+//   - logshare_logs_streamed_total, a counter of logs streamed; and
+//   - logshare_request_errors_total, a counter of failed requests labeled by
+//     the HTTP status code of the response, or "none" if there wasn't one.
+type Metrics struct {
+	duration prom.Histogram
+	logs     prom.Counter
+	errors   *prom.CounterVec
+}
+
+var _ logshare.Metrics = (*Metrics)(nil)
+
+// New returns Metrics registered with reg, for use as logshare.Options.Metrics.
+func New(reg prom.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		duration: prom.NewHistogram(prom.HistogramOpts{
+			Name: "logshare_request_duration_seconds",
+			Help: "Duration of requests to the Logpull API, including streaming their logs.",
+			// Pulls range from sub-second lookups to many minutes of streaming.
+			Buckets: prom.ExponentialBuckets(0.1, 2, 14),
+		}),
+		logs: prom.NewCounter(prom.CounterOpts{
+			Name: "logshare_logs_streamed_total",
+			Help: "Number of logs streamed from the Logpull API.",
+		}),
+		errors: prom.NewCounterVec(prom.CounterOpts{
+			Name: "logshare_request_errors_total",
+			Help: "Number of failed requests to the Logpull API, by HTTP status code.",
+		}, []string{"status"}),
+	}
+
+	for _, c := range []prom.Collector{m.duration, m.logs, m.errors} {
+		if err := reg.Register(c); err != nil {
+			return nil, errors.Wrap(err, "failed to register metrics")
+		}
+	}
+
+	return m, nil
+}
+
+// ObserveRequest implements logshare.Metrics.
+func (m *Metrics) ObserveRequest(duration time.Duration, count int, statusCode int, err error) {
+	m.duration.Observe(duration.Seconds())
+	m.logs.Add(float64(count))
+
+	if err != nil {
+		status := "none"
+		if statusCode != 0 {
+			status = strconv.Itoa(statusCode)
+		}
+		m.errors.WithLabelValues(status).Inc()
+	}
+}
@@ -0,0 +1,66 @@
+package logshare
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// resetEpochThreshold separates a rate limit reset given as a Unix timestamp
+// from one given as a number of seconds from now.
+const resetEpochThreshold = 1000000000
+
+// RateLimit describes the API's rate limit as reported with a response, which
+// callers can use to pace later requests before the API answers with 429 Too
+// Many Requests.
+type RateLimit struct {
+	// The number of requests allowed in the current period.
+	Limit int `json:"limit"`
+	// The number of requests left in the current period.
+	Remaining int `json:"remaining"`
+	// When the current period ends.
+	Reset time.Time `json:"reset"`
+}
+
+// parseRateLimit reads the rate limit from the X-RateLimit-* headers, or the
+// RateLimit-* headers that Cloudflare also sends. Reset may be given either as
+// a Unix timestamp or as a number of seconds from now. It returns a zero
+// RateLimit if the headers are absent or any of them is malformed.
+func parseRateLimit(h http.Header, now time.Time) RateLimit {
+	header := func(name string) string {
+		if v := h.Get("X-RateLimit-" + name); v != "" {
+			return v
+		}
+		return h.Get("RateLimit-" + name)
+	}
+
+	var rl RateLimit
+	for _, f := range []struct {
+		name string
+		v    *int
+	}{{"Limit", &rl.Limit}, {"Remaining", &rl.Remaining}} {
+		s := header(f.name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return RateLimit{}
+		}
+		*f.v = n
+	}
+
+	if s := header("Reset"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 0 {
+			return RateLimit{}
+		}
+		if n >= resetEpochThreshold {
+			rl.Reset = time.Unix(n, 0)
+		} else {
+			rl.Reset = now.Add(time.Duration(n) * time.Second)
+		}
+	}
+
+	return rl
+}
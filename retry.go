@@ -0,0 +1,116 @@
+package logshare
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetryBackoff    = time.Second
+	defaultRetryMaxBackoff = 30 * time.Second
+)
+
+// RetryPolicy configures retries of requests that fail with a transient HTTP
+// status: 429, 500, 502, 503 or 504. Such failures happen before any logs
+// have been streamed, so retrying never duplicates logs.
+type RetryPolicy struct {
+	// The maximum number of attempts, including the first. Values below 2
+	// disable retries.
+	MaxAttempts int
+	// The wait before the first retry, doubling for each retry after it.
+	// Defaults to one second.
+	Backoff time.Duration
+	// The longest wait between attempts. Defaults to 30 seconds. A
+	// Retry-After header from the API is honored, up to this limit.
+	MaxBackoff time.Duration
+}
+
+// retryable reports whether a request that returned meta and err may be
+// retried.
+func retryable(meta *Meta, err error) bool {
+	if err == nil || meta == nil || meta.Count > 0 {
+		return false
+	}
+
+	switch meta.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// wait returns how long to wait before the given retry (starting from 1),
+// preferring the API's Retry-After if it sent one.
+func (p *RetryPolicy) wait(retry int, retryAfter time.Duration) time.Duration {
+	max := p.MaxBackoff
+	if max <= 0 {
+		max = defaultRetryMaxBackoff
+	}
+
+	d := retryAfter
+	if d <= 0 {
+		d = p.Backoff
+		if d <= 0 {
+			d = defaultRetryBackoff
+		}
+		for i := 1; i < retry && d < max; i++ {
+			d *= 2
+		}
+	}
+
+	if d > max {
+		d = max
+	}
+
+	return d
+}
+
+// parseRetryAfter parses a Retry-After header, given either as a number of
+// seconds or as an HTTP date. It returns zero if the header is absent or
+// invalid.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(header); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+
+	return 0
+}
+
+// requestWithRetries makes the request, retrying transient failures according
+// to the client's RetryPolicy, and records the number of attempts in the
+// returned Meta.
+func (c *Client) requestWithRetries(ctx context.Context, u *url.URL, fn func(log []byte) error) (*Meta, error) {
+	for attempt := 1; ; attempt++ {
+		meta, err := c.breakerRequest(ctx, u, fn)
+		if meta != nil {
+			meta.Attempts = attempt
+		}
+
+		if c.retry == nil || attempt >= c.retry.MaxAttempts || !retryable(meta, err) {
+			return meta, err
+		}
+
+		wait := c.retry.wait(attempt, meta.retryAfter)
+		c.logger.Printf("logshare: retrying %s in %v after attempt %d of %d failed with HTTP status %d", u.Path, wait, attempt, c.retry.MaxAttempts, meta.StatusCode)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return meta, err
+		case <-timer.C:
+		}
+	}
+}
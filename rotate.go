@@ -0,0 +1,112 @@
+package logshare
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RotatingFileWriter writes logs to files in a directory, rolling over to a
+// new file each time maxBytes have been written to the current one. Files are
+// only ever rolled over between writes, and the client writes each log in a
+// single call, so logs are never split across files; a file may exceed
+// maxBytes by up to one log. Use it as a Dest or MultiDest writer. It is not
+// safe for concurrent use; wrap it with NewSyncWriter if it must be.
+//
+// Files are named by inserting an index before the extension of name, e.g.
+// logs_0000.json, logs_0001.json. With no limit, everything is written to a
+// single file named name.
+type RotatingFileWriter struct {
+	dir   string
+	name  string
+	limit int64
+
+	f     *os.File
+	n     int64
+	files []string
+}
+
+// NewRotatingFileWriter returns a RotatingFileWriter writing files named after
+// name to dir, which is created if it does not exist. A maxBytes of zero
+// disables rotation.
+func NewRotatingFileWriter(dir string, name string, maxBytes int64) (*RotatingFileWriter, error) {
+	if maxBytes < 0 {
+		return nil, errors.New("maxBytes cannot be negative")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "failed to create output directory")
+	}
+
+	return &RotatingFileWriter{dir: dir, name: name, limit: maxBytes}, nil
+}
+
+func (w *RotatingFileWriter) Write(p []byte) (int, error) {
+	if w.f != nil && w.limit > 0 && w.n >= w.limit {
+		if err := w.closeFile(); err != nil {
+			return 0, err
+		}
+	}
+
+	if w.f == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.f.Write(p)
+	w.n += int64(n)
+
+	return n, errors.Wrapf(err, "failed to write to %s", w.f.Name())
+}
+
+// Close closes the current file. An empty file is created if nothing was
+// written, so that a pull always produces output.
+func (w *RotatingFileWriter) Close() error {
+	if w.f == nil && len(w.files) == 0 {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+
+	if w.f == nil {
+		return nil
+	}
+
+	return w.closeFile()
+}
+
+// Files returns the paths of the files written so far, in order.
+func (w *RotatingFileWriter) Files() []string {
+	return append([]string(nil), w.files...)
+}
+
+func (w *RotatingFileWriter) open() error {
+	name := w.name
+	if w.limit > 0 {
+		ext := filepath.Ext(name)
+		name = fmt.Sprintf("%s_%04d%s", strings.TrimSuffix(name, ext), len(w.files), ext)
+	}
+
+	f, err := os.Create(filepath.Join(w.dir, name))
+	if err != nil {
+		return errors.Wrap(err, "failed to create output file")
+	}
+
+	w.f = f
+	w.n = 0
+	w.files = append(w.files, f.Name())
+
+	return nil
+}
+
+func (w *RotatingFileWriter) closeFile() error {
+	err := w.f.Close()
+	name := w.f.Name()
+	w.f = nil
+
+	return errors.Wrapf(err, "failed to close %s", name)
+}
@@ -0,0 +1,78 @@
+package logshare
+
+import (
+	"context"
+	"net/url"
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+// logScope identifies the logs a request is for: those of a zone, or those of
+// one of an account's datasets.
+type logScope struct {
+	zoneID    string
+	accountID string
+	dataset   string
+}
+
+func zoneScope(zoneID string) logScope {
+	return logScope{zoneID: zoneID}
+}
+
+func accountScope(accountID string, dataset string) logScope {
+	return logScope{accountID: accountID, dataset: dataset}
+}
+
+func (s logScope) isAccount() bool {
+	return s.accountID != ""
+}
+
+// path returns the path of the scope's logs, relative to the API endpoint.
+func (s logScope) path() string {
+	if s.isAccount() {
+		return path.Join("accounts", s.accountID, "logs", s.dataset)
+	}
+
+	return path.Join("zones", s.zoneID, "logs")
+}
+
+// scopeFields returns the fields to request for the scope. Options.FieldsByZone
+// and Options.AllFields only apply to zones.
+func (c *call) scopeFields(scope logScope) []string {
+	if scope.isAccount() {
+		return c.fields
+	}
+
+	return c.requestFields(scope.zoneID)
+}
+
+// scopeRequest performs a request for the scope's logs, remembering zones
+// found not to have Log Share enabled (see zoneRequest).
+func (c *call) scopeRequest(ctx context.Context, scope logScope, u *url.URL, fn func(log []byte) error) (*Meta, error) {
+	if scope.isAccount() {
+		return c.request(ctx, u, fn)
+	}
+
+	return c.zoneRequest(ctx, scope.zoneID, u, fn)
+}
+
+// GetAccountLogs fetches up to 'count' logs of an account-level dataset, such
+// as firewall events or Gateway logs, between the start and end timestamps (in
+// Unix seconds). Logs are requested from
+// /accounts/<accountID>/logs/<dataset>/received and handled as
+// GetFromTimestamp handles a zone's logs, except that Options.FieldsByZone,
+// Options.AllFields and Options.ValidateFields only apply to zones. Since
+// AllLogs is fetched with a request per window, count cannot be AllLogs.
+func (c *Client) GetAccountLogs(accountID string, dataset string, start int64, end int64, count int) (*Meta, error) {
+	cl := c.startCall()
+	if accountID == "" || dataset == "" {
+		return cl.finish(nil, errors.New("accountID and dataset cannot be empty"))
+	}
+
+	if count == AllLogs {
+		return cl.finish(nil, errors.New("AllLogs is not supported for account datasets"))
+	}
+
+	return cl.finish(cl.getFromScope(context.Background(), accountScope(accountID, dataset), start, end, count, cl.writeLog))
+}
@@ -0,0 +1,55 @@
+package logshare
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CheckClockSkew makes a small request to the API (for the zone's field
+// listing) and returns how far the local clock is behind the API's, based on
+// the response's Date header: a positive skew means the local clock is slow.
+// The Date header has a resolution of one second, so skews smaller than that
+// cannot be detected.
+//
+// Windows are requested relative to the local clock, so a skewed clock can
+// lead to requests for logs that are not available yet, or that have aged out.
+func (c *Client) CheckClockSkew(zoneID string) (time.Duration, error) {
+	u, err := c.fieldsURL(zoneID)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := c.newRequest(context.Background(), "GET", u, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := c.waitRateLimit(req.Context()); err != nil {
+		return 0, err
+	}
+
+	sent := c.now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "HTTP request failed")
+	}
+	received := c.now()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<20))
+	resp.Body.Close()
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, errors.Errorf("HTTP status %d: response has no valid Date header", resp.StatusCode)
+	}
+
+	// Compare against the middle of the request, when the API most likely
+	// generated its response.
+	local := sent.Add(received.Sub(sent) / 2)
+
+	return date.Sub(local).Truncate(time.Second), nil
+}
@@ -0,0 +1,37 @@
+package logshare
+
+import "bytes"
+
+// recordSeparator is the ASCII RS character that begins each record in a JSON
+// text sequence (RFC 7464).
+const recordSeparator = 0x1e
+
+// ScanRecords is a bufio.SplitFunc for JSON text sequences, where each log is
+// preceded by an RS (0x1e) character and typically followed by a newline.
+// Surrounding whitespace is trimmed from each record and empty records are
+// skipped.
+func ScanRecords(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	start := 0
+	for start < len(data) && (data[start] == recordSeparator || isSpace(data[start])) {
+		start++
+	}
+
+	if start == len(data) {
+		return start, nil, nil
+	}
+
+	if end := bytes.IndexByte(data[start:], recordSeparator); end >= 0 {
+		return start + end, bytes.TrimSpace(data[start : start+end]), nil
+	}
+
+	if atEOF {
+		return len(data), bytes.TrimSpace(data[start:]), nil
+	}
+
+	// Request more data.
+	return start, nil, nil
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
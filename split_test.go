@@ -0,0 +1,70 @@
+package logshare
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestScanRecords(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"\x1e{\"a\":1}\n\x1e{\"a\":2}\n", []string{`{"a":1}`, `{"a":2}`}},
+		// The last record need not end with a newline.
+		{"\x1e{\"a\":1}\n\x1e{\"a\":2}", []string{`{"a":1}`, `{"a":2}`}},
+		// Empty records and surrounding whitespace are skipped.
+		{"\x1e\x1e {\"a\":1} \r\n\x1e\n", []string{`{"a":1}`}},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		// Reading a byte at a time splits records across reads.
+		scanner := bufio.NewScanner(iotest.OneByteReader(strings.NewReader(tt.input)))
+		scanner.Split(ScanRecords)
+
+		var got []string
+		for scanner.Scan() {
+			got = append(got, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%q: got %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSplitFunc(t *testing.T) {
+	ts := newTestServer(t, "{\"a\":1};{\"a\":2};{\"a\":3}")
+	defer ts.Close()
+
+	// A custom split func frames the response, here by semicolons.
+	splitSemicolons := func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, ';'); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+
+	var buf bytes.Buffer
+	client, err := New("key", "email", &Options{ApiURL: ts.URL + "/", Dest: &buf, SplitFunc: splitSemicolons})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := client.GetFromTimestamp("zone", 1, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\"a\":1}\n{\"a\":2}\n{\"a\":3}\n"; buf.String() != want || meta.Count != 3 {
+		t.Errorf("got Count %d and %q, want 3 and %q", meta.Count, buf.String(), want)
+	}
+}
@@ -0,0 +1,65 @@
+package logshare
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// tailJitter is the largest fraction of the interval added to each of Tail's
+// sleeps, so that many tailing clients do not poll in lockstep.
+const tailJitter = 0.1
+
+// Tail continuously streams new logs for the zone to the client's destination,
+// like tail -f, until ctx is cancelled. Every interval (plus up to 10%
+// jitter) it fetches all logs received since the last pull, up to lookback
+// before now. The first pull covers the interval before that.
+//
+// Logs only become available to the API after a delay, so lookback is raised
+// to at least a minute; a few minutes avoids missing logs that arrive late.
+// Consecutive windows share their boundaries, so no log is fetched twice.
+// Windows without logs are skipped. Tail returns ctx.Err() once ctx is
+// cancelled, or the first other error, including ErrNotEntitled for a zone
+// without Log Share.
+func (c *Client) Tail(ctx context.Context, zoneID string, lookback time.Duration, interval time.Duration) error {
+	cl := c.startCall()
+	if interval <= 0 {
+		return errors.New("interval must be positive")
+	}
+
+	if lookback < minEndAge {
+		lookback = minEndAge
+	}
+
+	_, err := cl.finish(nil, cl.tail(ctx, zoneID, lookback, interval))
+	return err
+}
+
+func (c *call) tail(ctx context.Context, zoneID string, lookback time.Duration, interval time.Duration) error {
+	start := c.now().Add(-lookback - interval).Unix()
+
+	for {
+		if end := c.now().Add(-lookback).Unix(); end > start {
+			_, err := c.getFromTimestampCount(ctx, zoneID, start, end, AllLogs)
+			if err != nil && (errors.Cause(err) != ErrNoLogs || isNotEntitled(err)) {
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return ctxErr
+				}
+				return wrapf(err, "failed to tail logs from %d to %d", start, end)
+			}
+
+			start = end
+		}
+
+		sleep := interval + time.Duration(rand.Float64()*tailJitter*float64(interval))
+		timer := time.NewTimer(sleep)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
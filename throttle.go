@@ -0,0 +1,35 @@
+package logshare
+
+import (
+	"sync"
+	"time"
+)
+
+// throttle paces writes to a steady number of bytes per second. It is shared
+// by every writer of a client, so concurrent calls share the budget.
+type throttle struct {
+	mu   sync.Mutex
+	rate int64
+	// The time at which the next write may start.
+	next time.Time
+}
+
+func newThrottle(bytesPerSecond int64) *throttle {
+	return &throttle{rate: bytesPerSecond}
+}
+
+// wait blocks until n more bytes may be written without exceeding the rate.
+func (t *throttle) wait(n int) {
+	t.mu.Lock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	delay := t.next.Sub(now)
+	t.next = t.next.Add(time.Duration(int64(n) * int64(time.Second) / t.rate))
+	t.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
@@ -0,0 +1,71 @@
+package logshare
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestThrottleWrites(t *testing.T) {
+	ts := newTestServer(t, "{\"a\":1}\n{\"a\":2}\n{\"a\":3}\n")
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	client, err := New("key", "email", &Options{ApiURL: ts.URL + "/", Dest: &buf, ThrottleWrites: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each log and its newline is 8 bytes, so the second and third wait for
+	// 200ms each at 40 bytes per second.
+	meta, err := client.GetFromTimestamp("zone", 0, 120, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.WriteWaitTime < 300 {
+		t.Errorf("got WriteWaitTime %dms, want at least 300ms", meta.WriteWaitTime)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	ts := newTestServer(t, "{}\n")
+	defer ts.Close()
+
+	client, err := New("key", "email", &Options{ApiURL: ts.URL + "/", Dest: ioutil.Discard, RateLimit: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := client.GetFromTimestamp("zone", 1, 2, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The first request starts at once, and each later one 50ms after the
+	// last.
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("3 requests at 20 per second took %v, want at least 100ms", elapsed)
+	}
+}
+
+func TestRateLimitCancelled(t *testing.T) {
+	ts := newTestServer(t, "{}\n")
+	defer ts.Close()
+
+	client, err := New("key", "email", &Options{ApiURL: ts.URL + "/", Dest: ioutil.Discard, RateLimit: 0.1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetFromTimestamp("zone", 1, 2, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.GetFromTimestampContext(ctx, "zone", 1, 2, 0); err == nil {
+		t.Fatal("expected the rate limit wait to be cancelled")
+	}
+}
@@ -0,0 +1,206 @@
+package logshare
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultMinWindow = time.Minute
+	defaultMaxWindow = time.Hour
+)
+
+// GetFromTimeRange fetches all logs between the start and end timestamps (in
+// Unix seconds) by splitting the range into consecutive windows of the given
+// size and requesting up to 'count' logs from each in turn. Windows without
+// any logs are skipped. Each window starts where the last one ended, and the
+// API includes logs received at a window's start but not at its end, so no log
+// is fetched twice or missed at the boundaries.
+//
+// With Options.AdaptiveWindow set, the window size changes as the range is
+// walked: it doubles after a window returns fewer than a quarter of 'count'
+// logs, within the bounds of Options.MinWindow and Options.MaxWindow. A window
+// truncated by reaching 'count' is fetched again from the same start at half
+// the size, until it is no longer truncated or MinWindow is reached, in which
+// case the truncated window is kept and Meta.Truncated is set. The logs of
+// each window are then held in memory until it is final. Adaptive sizing has
+// no effect unless count > 0.
+//
+// The returned Meta aggregates the windows: Count and Duration are totals, and
+// Truncated is set if any window was truncated. Meta.Chunks describes each
+// window, which helps to spot slow or dense parts of the range. Set
+// Options.ProgressFunc to follow the range as it is walked.
+//
+// An end of 0 walks the range up to the latest end the API accepts, a minute
+// before now.
+func (c *Client) GetFromTimeRange(zoneID string, start int64, end int64, window time.Duration, count int) (*Meta, error) {
+	cl := c.startCall()
+	return cl.finish(cl.getFromTimeRange(context.Background(), zoneID, start, end, window, count))
+}
+
+func (c *call) getFromTimeRange(ctx context.Context, zoneID string, start int64, end int64, window time.Duration, count int) (*Meta, error) {
+	if window <= 0 {
+		return nil, errors.New("window must be positive")
+	}
+
+	// As for a single request, no end means up to now, less the delay before
+	// logs become available.
+	if end == 0 {
+		end = c.now().Add(-minEndAge).Unix()
+	}
+
+	if end <= start {
+		return nil, errors.Errorf("end (%d) must be after start (%d)", end, start)
+	}
+
+	size := durationSeconds(window)
+	total := &Meta{}
+	began := c.makeTimestamp()
+
+	for from := start; from < end; {
+		// Stop between windows once ctx is cancelled, keeping the logs
+		// already written.
+		if err := ctx.Err(); err != nil {
+			total.Duration = c.makeTimestamp() - began
+			return total, err
+		}
+
+		to := from + size
+		if to > end {
+			to = end
+		}
+
+		var meta *Meta
+		var err error
+		if c.adaptiveWindow && count > 0 {
+			meta, to, err = c.getAdaptiveWindow(ctx, zoneID, from, to, count)
+			size = to - from
+		} else {
+			meta, err = c.getFromTimestamp(ctx, zoneID, from, to, count)
+		}
+		if meta != nil {
+			mergeMeta(total, meta)
+			total.Chunks = append(total.Chunks, ChunkInfo{
+				Start:      from,
+				End:        to,
+				Count:      meta.Count,
+				Duration:   meta.Duration,
+				StatusCode: meta.StatusCode,
+				Truncated:  meta.Truncated,
+			})
+		}
+
+		// An empty window is not an error when walking a range, even with
+		// Options.TreatEmptyAsError set, but a zone without Log Share is.
+		empty := meta != nil && !isNotEntitled(err) && (meta.StatusCode == http.StatusNoContent || errors.Cause(err) == ErrNoLogs)
+		if err != nil && !empty {
+			total.Duration = c.makeTimestamp() - began
+			return total, wrapf(err, "failed to fetch window %d-%d", from, to)
+		}
+
+		c.logger.Printf("logshare: fetched window %d-%d of zone %s, %d logs so far", from, to, zoneID, total.Count)
+		if c.windowProgress != nil {
+			c.windowProgress(from, to, total.Count)
+		}
+
+		if c.adaptiveWindow && count > 0 && meta != nil {
+			size = c.adaptWindow(size, meta, count)
+		}
+
+		from = to
+	}
+
+	total.Duration = c.makeTimestamp() - began
+	return total, nil
+}
+
+// mergeMeta adds meta, the result of one request of a call made up of several,
+// to total: counts are summed, Truncated is set if either is, and the status,
+// URL and other details of the request replace those of total.
+func mergeMeta(total *Meta, meta *Meta) {
+	total.Count += meta.Count
+	total.BytesRead += meta.BytesRead
+	total.ScannedCount += meta.ScannedCount
+	total.Attempts += meta.Attempts
+	if meta.LastRayID != "" {
+		total.LastRayID = meta.LastRayID
+	}
+	total.StatusCode = meta.StatusCode
+	total.URL = meta.URL
+	total.ContentEncoding = meta.ContentEncoding
+	total.RateLimit = meta.RateLimit
+	total.Truncated = total.Truncated || meta.Truncated
+}
+
+// getAdaptiveWindow fetches the window from start to end, halving it while it
+// is truncated and larger than Options.MinWindow, and returns the end of the
+// window fetched. The logs of each attempt are held until the window is
+// final, so that none is written twice; the Meta counts the attempts of them
+// all.
+func (c *call) getAdaptiveWindow(ctx context.Context, zoneID string, start int64, end int64, count int) (*Meta, int64, error) {
+	min := durationSeconds(c.minWindow)
+	attempts := 0
+	for {
+		var logs [][]byte
+		meta, err := c.getFromTimestampFunc(ctx, zoneID, start, end, count, func(log []byte) error {
+			logs = append(logs, append([]byte(nil), log...))
+			return nil
+		})
+		if meta == nil {
+			return nil, end, err
+		}
+		attempts += meta.Attempts
+
+		if err == nil && meta.Truncated && end-start > min {
+			size := (end - start) / 2
+			if size < min {
+				size = min
+			}
+			c.logger.Printf("logshare: window %d-%d of zone %s was truncated, retrying %d-%d", start, end, zoneID, start, start+size)
+			end = start + size
+			continue
+		}
+		meta.Attempts = attempts
+
+		s, werr := replayLogs(ctx, logs, c.writeLog)
+		s.record(meta)
+		if err == nil {
+			err = werr
+		}
+
+		return meta, end, err
+	}
+}
+
+// adaptWindow returns the size (in seconds) of the next window, given the
+// result of the last one.
+func (c *Client) adaptWindow(size int64, last *Meta, count int) int64 {
+	switch {
+	case last.Truncated:
+		size /= 2
+	case last.ScannedCount < count/4:
+		size *= 2
+	}
+
+	if min := durationSeconds(c.minWindow); size < min {
+		size = min
+	}
+
+	if max := durationSeconds(c.maxWindow); size > max {
+		size = max
+	}
+
+	return size
+}
+
+// durationSeconds converts d to whole seconds, with a minimum of one.
+func durationSeconds(d time.Duration) int64 {
+	if s := int64(d / time.Second); s > 0 {
+		return s
+	}
+
+	return 1
+}
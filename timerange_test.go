@@ -0,0 +1,156 @@
+package logshare
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// newDensityServer returns a server answering each request with two logs if
+// its window is longer than a minute and one otherwise, recording the
+// windows requested.
+func newDensityServer(windows *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		*windows = append(*windows, q.Get("start")+"-"+q.Get("end"))
+		start, _ := strconv.ParseInt(q.Get("start"), 10, 64)
+		end, _ := strconv.ParseInt(q.Get("end"), 10, 64)
+
+		fmt.Fprintf(w, "{\"start\":%d,\"n\":1}\n", start)
+		if end-start > 60 {
+			fmt.Fprintf(w, "{\"start\":%d,\"n\":2}\n", start)
+		}
+	}))
+}
+
+func TestAdaptiveWindowRefetchesTruncated(t *testing.T) {
+	var windows []string
+	ts := newDensityServer(&windows)
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	client, err := New("key", "email", &Options{ApiURL: ts.URL + "/", Dest: &buf, AdaptiveWindow: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := client.GetFromTimeRange("zone", 0, 240, 4*time.Minute, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"0-240", "0-120", "0-60", "60-120", "120-180", "180-240"}
+	if strings.Join(windows, " ") != strings.Join(want, " ") {
+		t.Errorf("got windows %v, want %v", windows, want)
+	}
+	if meta.Count != 4 || meta.Truncated {
+		t.Errorf("got Count %d and Truncated %v, want 4 and false", meta.Count, meta.Truncated)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 4 {
+		t.Errorf("got %d logs written, want 4:\n%s", lines, buf.String())
+	}
+}
+
+func TestAdaptiveWindowTruncatedAtMinimum(t *testing.T) {
+	var windows []string
+	ts := newDensityServer(&windows)
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	client, err := New("key", "email", &Options{ApiURL: ts.URL + "/", Dest: &buf, AdaptiveWindow: true, MinWindow: 2 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := client.GetFromTimeRange("zone", 0, 240, 4*time.Minute, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"0-240", "0-120", "120-240"}
+	if strings.Join(windows, " ") != strings.Join(want, " ") {
+		t.Errorf("got windows %v, want %v", windows, want)
+	}
+	if meta.Count != 4 || !meta.Truncated {
+		t.Errorf("got Count %d and Truncated %v, want 4 and true", meta.Count, meta.Truncated)
+	}
+	if len(meta.Chunks) != 2 || !meta.Chunks[0].Truncated {
+		t.Errorf("got chunks %+v, want two truncated ones", meta.Chunks)
+	}
+}
+
+func TestAllLogsCancelledBetweenWindows(t *testing.T) {
+	var windows []string
+	ts := newDensityServer(&windows)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var buf bytes.Buffer
+	client, err := New("key", "email", &Options{
+		ApiURL:       ts.URL + "/",
+		Dest:         &buf,
+		ProgressFunc: func(int64, int64, int) { cancel() },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	end := client.now().Add(-10 * time.Minute).Unix()
+	meta, err := client.GetFromTimestampContext(ctx, "zone", end-300, end, AllLogs)
+	if errors.Cause(err) != context.Canceled {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+
+	// The first window's logs are kept, and no further window is requested.
+	if len(windows) != 1 {
+		t.Fatalf("got windows %v, want only the first", windows)
+	}
+	if meta == nil || meta.Count != 1 || len(meta.Chunks) != 1 {
+		t.Fatalf("got meta %+v, want the first window's", meta)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != meta.Count {
+		t.Fatalf("wrote %d logs, but Meta.Count is %d", lines, meta.Count)
+	}
+}
+
+func TestAllLogsWithoutEnd(t *testing.T) {
+	var windows []string
+	ts := newDensityServer(&windows)
+	defer ts.Close()
+
+	client, err := New("key", "email", &Options{ApiURL: ts.URL + "/", Dest: ioutil.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1000000, 0)
+	client.now = func() time.Time { return now }
+
+	// An end of 0 walks the range up to a minute before now.
+	start := now.Add(-4 * time.Minute).Unix()
+	if _, err := client.GetFromTimestamp("zone", start, 0, AllLogs); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		fmt.Sprintf("%d-%d", start, start+60),
+		fmt.Sprintf("%d-%d", start+60, start+120),
+		fmt.Sprintf("%d-%d", start+120, start+180),
+	}
+	if strings.Join(windows, ",") != strings.Join(want, ",") {
+		t.Errorf("got windows %v, want %v", windows, want)
+	}
+
+	if _, err := client.GetFromTimeRange("zone", start, 0, 0, 0); err == nil {
+		t.Error("got no error for a window of 0")
+	}
+}
@@ -0,0 +1,107 @@
+package logshare
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// canonicalizeKeys re-encodes a JSON log with its object keys (including those
+// of nested objects) sorted alphabetically. Numbers are preserved verbatim.
+func canonicalizeKeys(log []byte) ([]byte, error) {
+	var record interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(log))
+	dec.UseNumber()
+	if err := dec.Decode(&record); err != nil {
+		return nil, errors.Wrap(err, "failed to decode log")
+	}
+
+	return encodeLog(record)
+}
+
+// aliasKeys re-encodes a JSON log with its top-level keys renamed according
+// to aliases. A renamed key replaces any key already using its alias. Logs
+// that are not objects are returned unchanged.
+func aliasKeys(log []byte, aliases map[string]string) ([]byte, error) {
+	var record map[string]interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(log))
+	dec.UseNumber()
+	if err := dec.Decode(&record); err != nil {
+		if _, ok := err.(*json.UnmarshalTypeError); ok {
+			return log, nil
+		}
+		return nil, errors.Wrap(err, "failed to decode log")
+	}
+
+	renamed := make(map[string]interface{}, len(record))
+	for key, value := range record {
+		if _, ok := aliases[key]; !ok {
+			renamed[key] = value
+		}
+	}
+	for key, value := range record {
+		if alias, ok := aliases[key]; ok {
+			renamed[alias] = value
+		}
+	}
+
+	return encodeLog(renamed)
+}
+
+// aliasFields returns fields renamed according to aliases. It returns fields
+// itself when there are no aliases.
+func aliasFields(fields []string, aliases map[string]string) []string {
+	if len(aliases) == 0 {
+		return fields
+	}
+
+	renamed := make([]string, len(fields))
+	for i, field := range fields {
+		if alias, ok := aliases[field]; ok {
+			field = alias
+		}
+		renamed[i] = field
+	}
+
+	return renamed
+}
+
+// encodeLog encodes v as compact JSON without HTML escaping or a trailing
+// newline. Maps are encoded with their keys in sorted order.
+func encodeLog(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, errors.Wrap(err, "failed to encode log")
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// injectField inserts "key":value as the first member of a JSON object log,
+// where value is raw JSON. Logs that are not objects are returned unchanged.
+func injectField(log []byte, key string, value string) []byte {
+	trimmed := bytes.TrimLeft(log, " \t\r")
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return log
+	}
+
+	name, _ := json.Marshal(key)
+	out := make([]byte, 0, len(trimmed)+len(name)+len(value)+2)
+	out = append(out, '{')
+	out = append(out, name...)
+	out = append(out, ':')
+	out = append(out, value...)
+
+	rest := trimmed[1:]
+	if next := bytes.TrimLeft(rest, " \t\r\n"); len(next) > 0 && next[0] != '}' {
+		out = append(out, ',')
+	}
+
+	return append(out, rest...)
+}
@@ -0,0 +1,51 @@
+package logshare
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCanonicalizeKeys(t *testing.T) {
+	tests := []struct {
+		log  string
+		want string
+	}{
+		{`{"b":1,"a":2}`, `{"a":2,"b":1}`},
+		{`{"b":1,"a":{"z":1.50,"y":"<x>"},"c":null}`, `{"a":{"y":"<x>","z":1.50},"b":1,"c":null}`},
+		{`{"a":[{"d":1,"c":2}],"b":"&"}`, `{"a":[{"c":2,"d":1}],"b":"&"}`},
+		{`{ "a" : 12345678901234567890 }`, `{"a":12345678901234567890}`},
+	}
+
+	for _, tt := range tests {
+		got, err := canonicalizeKeys([]byte(tt.log))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.log, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.log, got, tt.want)
+		}
+	}
+
+	if _, err := canonicalizeKeys([]byte("nope")); err == nil {
+		t.Fatal("expected an error for a log that is not JSON")
+	}
+}
+
+func TestCanonicalizeKeysOption(t *testing.T) {
+	ts := newTestServer(t, "{\"b\":1,\"a\":2}\n{\"a\":2,\"b\":1}\n")
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	client, err := New("key", "email", &Options{ApiURL: ts.URL, Dest: &buf, CanonicalizeKeys: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetFromTimestamp("zone", 1, 2, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "{\"a\":2,\"b\":1}\n{\"a\":2,\"b\":1}\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,61 @@
+//go:build go1.18
+// +build go1.18
+
+package logshare
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// GetTyped fetches logs as GetFromTimestamp does, decoding each into a T, e.g.
+// a struct with a field for each of Options.Fields:
+//
+//	type Request struct {
+//		RayID    string
+//		ClientIP string
+//	}
+//	logs, meta, err := logshare.GetTyped[Request](client, zoneID, start, end, 100)
+//
+// Every log is held in memory; use StreamTyped for large counts. Logs are not
+// written to the client's destination.
+func GetTyped[T any](c *Client, zoneID string, start int64, end int64, count int) ([]T, *Meta, error) {
+	cl := c.startCall()
+	var logs []T
+	meta, err := cl.finishRead(cl.getFromTimestampFunc(context.Background(), zoneID, start, end, count, func(log []byte) error {
+		var v T
+		if err := json.Unmarshal(log, &v); err != nil {
+			return errors.Wrap(err, "failed to decode log")
+		}
+
+		logs = append(logs, v)
+		return nil
+	}))
+
+	return logs, meta, err
+}
+
+// StreamTyped fetches logs as GetTyped does, but sends each to out as it is
+// read rather than collecting them, so memory use stays bounded however many
+// logs are fetched. Reading pauses while out is full. out is closed when
+// StreamTyped returns; cancelling ctx aborts the request.
+func StreamTyped[T any](ctx context.Context, c *Client, zoneID string, start int64, end int64, count int, out chan<- T) (*Meta, error) {
+	cl := c.startCall()
+	defer close(out)
+
+	return cl.finishRead(cl.getFromTimestampFunc(ctx, zoneID, start, end, count, func(log []byte) error {
+		var v T
+		if err := json.Unmarshal(log, &v); err != nil {
+			return errors.Wrap(err, "failed to decode log")
+		}
+
+		select {
+		case out <- v:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}))
+}
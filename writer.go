@@ -0,0 +1,232 @@
+package logshare
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SyncWriter wraps an io.Writer, serializing calls to Write so that a single
+// destination can be shared between goroutines. The client writes each log in
+// a single call to Write, so logs written through a SyncWriter are never
+// interleaved.
+type SyncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewSyncWriter returns a SyncWriter that writes to w.
+func NewSyncWriter(w io.Writer) *SyncWriter {
+	return &SyncWriter{w: w}
+}
+
+// Write writes p to the underlying writer while holding the lock.
+func (s *SyncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// WriterFunc adapts a function to an io.Writer, so that logs can be handled
+// inline, e.g. Options{Dest: logshare.WriterFunc(handle)}. The client writes
+// each log, with its line terminator, in a single call.
+type WriterFunc func(p []byte) (int, error)
+
+// Write calls f(p).
+func (f WriterFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// errDestClosed is returned when writing to a destination chain that the client
+// has already closed.
+var errDestClosed = errors.New("destination has been closed")
+
+type closedWriter struct{}
+
+func (closedWriter) Write([]byte) (int, error) {
+	return 0, errDestClosed
+}
+
+// multiError combines several errors into one.
+type multiError []error
+
+func (m multiError) Error() string {
+	msgs := make([]string, len(m))
+	for i, err := range m {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// combineErrors returns nil if errs is empty, the error itself if there is only
+// one, and a multiError otherwise.
+func combineErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return multiError(errs)
+}
+
+// call is the state of a single call to one of the client's methods, such as
+// sequence numbering and the warnings to report, kept apart from the Client so
+// that concurrent calls do not share it. It is created by startCall, passed to
+// the functions making up the call, and reported in the Meta by finish.
+type call struct {
+	*Client
+
+	// The last sequence number assigned with SequenceField, and the time
+	// spent writing logs in nanoseconds. Accessed atomically, so they are
+	// kept first for 64-bit alignment.
+	seq       int64
+	writeWait int64
+
+	observer *fieldObserver
+
+	mu       sync.Mutex
+	warnings []string
+	hasher   hash.Hash
+	// Zones probed for Log Share, and zones whose fields could not be
+	// listed, during the call.
+	probed   map[string]bool
+	unlisted map[string]bool
+}
+
+// startCall returns the state of a new call to the client.
+func (c *Client) startCall() *call {
+	cl := &call{Client: c}
+	if c.observeFields {
+		cl.observer = newFieldObserver()
+	}
+
+	return cl
+}
+
+// warn records a warning to report in the call's Meta.
+func (c *call) warn(format string, args ...interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.warnings = append(c.warnings, fmt.Sprintf(format, args...))
+}
+
+// finish records the time spent writing, any observed fields, the checksum and
+// any warnings of the call in meta, once a call that streams logs has
+// completed, and closes the writers the client owns (see closeOwned). Any
+// close errors are combined with err.
+func (c *call) finish(meta *Meta, err error) (*Meta, error) {
+	meta, err = c.finishRead(meta, err)
+	return meta, c.closeOwned(err)
+}
+
+// finishRead is finish for a call that reads logs without writing them to the
+// destination, such as DistinctValues: it records the call's results in meta,
+// but leaves the writers the client owns open for later calls.
+func (c *call) finishRead(meta *Meta, err error) (*Meta, error) {
+	if meta != nil {
+		meta.WriteWaitTime = int64(time.Duration(atomic.LoadInt64(&c.writeWait)) / time.Millisecond)
+		if c.observer != nil {
+			meta.ObservedFields = c.observer.take()
+		}
+
+		c.mu.Lock()
+		meta.Warnings = c.warnings
+		if c.hasher != nil {
+			meta.Checksum = hex.EncodeToString(c.hasher.Sum(nil))
+		}
+		c.mu.Unlock()
+	}
+
+	return meta, err
+}
+
+// closeOwned closes the writers the client owns, in reverse order of
+// construction, along with any open partition writers, once a call that
+// streams logs has completed. Any close errors are combined with err.
+func (c *Client) closeOwned(err error) error {
+	var errs []error
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	// Partition writers are reopened on demand, so unlike the destination
+	// chain they remain usable for later calls.
+	if c.partitioner != nil {
+		if perr := c.partitioner.closeAll(); perr != nil {
+			errs = append(errs, perr)
+		}
+	}
+
+	if len(c.closers) == 0 {
+		return combineErrors(errs)
+	}
+
+	for i := len(c.closers) - 1; i >= 0; i-- {
+		if cerr := c.closers[i].Close(); cerr != nil {
+			errs = append(errs, errors.Wrap(cerr, "failed to close destination"))
+		}
+	}
+
+	c.closers = nil
+	c.dest = closedWriter{}
+
+	return combineErrors(errs)
+}
+
+// Close releases the client's resources, for use with defer once the client is
+// no longer needed. It closes the writers the client owns that are still open,
+// such as those of DestChain, EncryptKey or CompressOutput if no call has
+// closed them yet, and any open partition writers. With Options.CloseDest, it
+// also closes Dest and the MultiDest writers. Idle connections of the default
+// HTTP client are closed too. Close returns the first error encountered; the
+// client cannot stream logs afterwards.
+func (c *Client) Close() error {
+	var first error
+	keep := func(err error) {
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+
+	for i := len(c.closers) - 1; i >= 0; i-- {
+		if err := c.closers[i].Close(); err != nil {
+			keep(errors.Wrap(err, "failed to close destination"))
+		}
+	}
+	c.closers = nil
+
+	if c.partitioner != nil {
+		keep(c.partitioner.closeAll())
+	}
+
+	for _, w := range c.userDests {
+		if closer, ok := w.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				keep(errors.Wrap(err, "failed to close destination"))
+			}
+		}
+	}
+	c.userDests = nil
+
+	if c.ownHTTPClient {
+		c.httpClient.CloseIdleConnections()
+	}
+
+	// Clones share the outputs slice, so replace it rather than its writers.
+	c.dest = closedWriter{}
+	outputs := make([]OutputSpec, len(c.outputs))
+	for i, out := range c.outputs {
+		outputs[i] = OutputSpec{Writer: closedWriter{}, Format: out.Format}
+	}
+	c.outputs = outputs
+
+	return first
+}
@@ -0,0 +1,129 @@
+package logshare
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestSyncWriter(t *testing.T) {
+	const workers, logs = 8, 200
+
+	var body strings.Builder
+	for i := 0; i < logs; i++ {
+		body.WriteString(`{"ClientIP":"192.0.2.1","RayID":"3a6b1c2d4e5f6071","EdgeStartTimestamp":1}` + "\n")
+	}
+	ts := newTestServer(t, body.String())
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	dest := NewSyncWriter(&buf)
+	client, err := New("key", "email", &Options{ApiURL: ts.URL, Dest: dest})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			if _, err := c.GetFromTimestamp("zone", 1, 2, 0); err != nil {
+				errs <- err
+			}
+		}(client.Clone())
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != workers*logs {
+		t.Fatalf("got %d lines, want %d", len(lines), workers*logs)
+	}
+	for i, line := range lines {
+		if line != `{"ClientIP":"192.0.2.1","RayID":"3a6b1c2d4e5f6071","EdgeStartTimestamp":1}` {
+			t.Fatalf("line %d was interleaved: %q", i, line)
+		}
+	}
+}
+
+func TestWriterFunc(t *testing.T) {
+	ts := newTestServer(t, "{\"a\":1}\n{\"a\":2}\n{\"a\":3}\n")
+	defer ts.Close()
+
+	var logs []string
+	client, err := New("key", "email", &Options{ApiURL: ts.URL, Dest: WriterFunc(func(p []byte) (int, error) {
+		logs = append(logs, string(p))
+		return len(p), nil
+	})})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := client.GetFromTimestamp("zone", 1, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != meta.Count || meta.Count != 3 {
+		t.Fatalf("got %d calls for a count of %d, want 3", len(logs), meta.Count)
+	}
+	for i, log := range logs {
+		if want := fmt.Sprintf("{\"a\":%d}\n", i+1); log != want {
+			t.Errorf("call %d: got %q, want %q", i, log, want)
+		}
+	}
+}
+
+// chainStage is a DestChain writer that records when it is closed.
+type chainStage struct {
+	name   string
+	closed *[]string
+	err    error
+}
+
+func (s *chainStage) Write(p []byte) (int, error) { return len(p), nil }
+
+func (s *chainStage) Close() error {
+	*s.closed = append(*s.closed, s.name)
+	return s.err
+}
+
+func TestDestChainClose(t *testing.T) {
+	ts := newTestServer(t, "{\"a\":1}\n")
+	defer ts.Close()
+
+	var closed []string
+	client, err := New("key", "email", &Options{ApiURL: ts.URL, DestChain: []io.WriteCloser{
+		&chainStage{name: "upload", closed: &closed, err: errors.New("upload failed")},
+		&chainStage{name: "encrypt", closed: &closed},
+		&chainStage{name: "gzip", closed: &closed, err: errors.New("gzip failed")},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every writer is closed, last first, even after one fails, and every
+	// close error is returned.
+	_, err = client.GetFromTimestamp("zone", 1, 2, 0)
+	if got, want := strings.Join(closed, ","), "gzip,encrypt,upload"; got != want {
+		t.Errorf("closed %s, want %s", got, want)
+	}
+	if err == nil || !strings.Contains(err.Error(), "gzip failed") || !strings.Contains(err.Error(), "upload failed") {
+		t.Errorf("got error %v, want both close errors", err)
+	}
+
+	// The chain is closed once, however many calls follow.
+	client.GetFromTimestamp("zone", 1, 2, 0)
+	if len(closed) != 3 {
+		t.Errorf("closed %v, want each writer once", closed)
+	}
+}